@@ -0,0 +1,122 @@
+// Package cgroupfs parses the files of cgroup v2 hierarchies into Go values.
+package cgroupfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"strconv"
+)
+
+// Max is the value of files set to max, i.e. without a limit.
+const Max = math.MaxUint64
+
+// ParseValue parses the file b with a single value, like memory.current. max
+// is parsed as Max.
+func ParseValue(b []byte) (uint64, error) {
+	v, _, _ := bytes.Cut(bytes.TrimSpace(b), []byte(" "))
+	if string(v) == "max" {
+		return Max, nil
+	}
+	value, err := strconv.ParseUint(string(v), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse value %q: %w", v, err)
+	}
+	return value, nil
+}
+
+// Limits are the limits and protections of a cgroup, in bytes or number of
+// processes. Limits that are not set are Max, protections are zero.
+type Limits struct {
+	MemoryMin, MemoryLow, MemoryHigh, MemoryMax uint64
+	SwapHigh, SwapMax                           uint64
+	ZswapMax                                    uint64
+	PidsMax                                     uint64
+}
+
+// Cgroup reads the files of the cgroup at Path in FS, e.g. the directory of
+// the cgroup relative to /sys/fs/cgroup in os.DirFS("/sys/fs/cgroup").
+type Cgroup struct {
+	FS   fs.FS
+	Path string
+}
+
+// read parses the file name of c with parse, read into a pooled buffer.
+func read[T any](c Cgroup, name string, parse func([]byte) (T, error)) (T, error) {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	b, err := fsDir{fsys: c.FS, dir: c.Path}.ReadFile(name, (*buf)[:0])
+	*buf = b
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := parse(b)
+	if err != nil {
+		return v, fmt.Errorf("%s: %w", name, err)
+	}
+	return v, nil
+}
+
+// Value reads the file name with a single value, like memory.current.
+func (c Cgroup) Value(name string) (uint64, error) {
+	return read(c, name, ParseValue)
+}
+
+// CPUStat reads cpu.stat.
+func (c Cgroup) CPUStat() (CPUStat, error) {
+	return read(c, "cpu.stat", ParseCPUStat)
+}
+
+// MemoryStat reads memory.stat.
+func (c Cgroup) MemoryStat() (MemoryStat, error) {
+	return read(c, "memory.stat", ParseMemoryStat)
+}
+
+// MemoryEvents reads memory.events.
+func (c Cgroup) MemoryEvents() (MemoryEvents, error) {
+	return read(c, "memory.events", ParseMemoryEvents)
+}
+
+// IOStat reads io.stat.
+func (c Cgroup) IOStat() ([]IOStat, error) {
+	return read(c, "io.stat", ParseIOStat)
+}
+
+// Pressure reads the pressure file of resource: cpu, memory, io or irq.
+func (c Cgroup) Pressure(resource string) (PSI, error) {
+	return read(c, resource+".pressure", ParsePSI)
+}
+
+// Limits reads the limits of the cgroup. The files of controllers that are
+// not enabled for the cgroup are skipped.
+func (c Cgroup) Limits() (Limits, error) {
+	l := Limits{
+		MemoryHigh: Max, MemoryMax: Max,
+		SwapHigh: Max, SwapMax: Max,
+		ZswapMax: Max,
+		PidsMax:  Max,
+	}
+	for name, value := range map[string]*uint64{
+		"memory.min":       &l.MemoryMin,
+		"memory.low":       &l.MemoryLow,
+		"memory.high":      &l.MemoryHigh,
+		"memory.max":       &l.MemoryMax,
+		"memory.swap.high": &l.SwapHigh,
+		"memory.swap.max":  &l.SwapMax,
+		"memory.zswap.max": &l.ZswapMax,
+		"pids.max":         &l.PidsMax,
+	} {
+		v, err := c.Value(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return l, err
+		}
+		*value = v
+	}
+	return l, nil
+}
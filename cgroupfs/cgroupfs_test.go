@@ -0,0 +1,56 @@
+package cgroupfs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseValue(t *testing.T) {
+	tests := map[string]uint64{"0\n": 0, "4096\n": 4096, "max\n": Max}
+	for s, expected := range tests {
+		if v, err := ParseValue([]byte(s)); err != nil || v != expected {
+			t.Errorf("%q: expected %d got %d, %v", s, expected, v, err)
+		}
+	}
+	if _, err := ParseValue([]byte("-1\n")); err == nil {
+		t.Error("expected error for negative value")
+	}
+}
+
+func TestCgroup(t *testing.T) {
+	c := Cgroup{FS: fstest.MapFS{
+		"system.slice/nginx.service/memory.current": &fstest.MapFile{Data: []byte("8192\n")},
+		"system.slice/nginx.service/memory.max":     &fstest.MapFile{Data: []byte("1048576\n")},
+		"system.slice/nginx.service/memory.high":    &fstest.MapFile{Data: []byte("max\n")},
+		"system.slice/nginx.service/memory.low":     &fstest.MapFile{Data: []byte("4096\n")},
+		"system.slice/nginx.service/cpu.stat":       &fstest.MapFile{Data: []byte("usage_usec 10\n")},
+		"system.slice/nginx.service/memory.events":  &fstest.MapFile{Data: []byte("oom 1\n")},
+		"system.slice/nginx.service/io.pressure":    &fstest.MapFile{Data: []byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=5\n")},
+	}, Path: "system.slice/nginx.service"}
+
+	if v, err := c.Value("memory.current"); err != nil || v != 8192 {
+		t.Errorf("expected memory.current 8192 got %d, %v", v, err)
+	}
+	limits, err := c.Limits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Limits{MemoryLow: 4096, MemoryHigh: Max, MemoryMax: 1048576, SwapHigh: Max, SwapMax: Max, ZswapMax: Max, PidsMax: Max}
+	if limits != expected {
+		t.Errorf("expected %+v got %+v", expected, limits)
+	}
+	if s, err := c.CPUStat(); err != nil || s.UsageUsec != 10 {
+		t.Errorf("expected usage_usec 10 got %+v, %v", s, err)
+	}
+	if e, err := c.MemoryEvents(); err != nil || e.Oom != 1 {
+		t.Errorf("expected oom 1 got %+v, %v", e, err)
+	}
+	if psi, err := c.Pressure("io"); err != nil || psi.Some.Total != 5 {
+		t.Errorf("expected io pressure total 5 got %+v, %v", psi, err)
+	}
+	if _, err := c.IOStat(); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected io.stat to not exist got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package cgroupfs
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// Dir is an open cgroup directory, whose files are read relative to it
+// instead of resolving their whole path.
+type Dir interface {
+	// ReadFile reads the file name of the directory, appending it to buf.
+	ReadFile(name string, buf []byte) ([]byte, error)
+	Close() error
+}
+
+// DirFS is a file system that can open directories as a Dir.
+type DirFS interface {
+	fs.FS
+
+	// OpenDir opens the directory name.
+	OpenDir(name string) (Dir, error)
+}
+
+// OpenDir opens the directory name of fsys. If fsys is not a DirFS, the files
+// of the directory are opened by their path in fsys.
+func OpenDir(fsys fs.FS, name string) (Dir, error) {
+	if d, ok := fsys.(DirFS); ok {
+		return d.OpenDir(name)
+	}
+	return fsDir{fsys: fsys, dir: name}, nil
+}
+
+// fsDir opens the files of the directory dir by their path in fsys.
+type fsDir struct {
+	fsys fs.FS
+	dir  string
+}
+
+func (d fsDir) ReadFile(name string, buf []byte) ([]byte, error) {
+	f, err := d.fsys.Open(path.Join(d.dir, name))
+	if err != nil {
+		return buf, err
+	}
+	buf, err = readAll(f, buf)
+	f.Close()
+	return buf, err
+}
+
+func (d fsDir) Close() error {
+	return nil
+}
+
+// readAll reads r until EOF, appending to buf.
+func readAll(r io.Reader, buf []byte) ([]byte, error) {
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return buf, err
+		}
+	}
+}
+
+// buffers are reused for reading files, which are small.
+var buffers = sync.Pool{New: func() any { b := make([]byte, 0, 4096); return &b }}
+
+// GetBuffer returns a buffer to read files into, like with Dir.ReadFile, from
+// a pool shared by the readers of cgroup files.
+func GetBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+// PutBuffer returns buf to the pool once what was read into it is no longer
+// used.
+func PutBuffer(buf *[]byte) {
+	buffers.Put(buf)
+}
@@ -0,0 +1,63 @@
+package cgroupfs
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// osDir is a directory of the operating system, whose files are opened with
+// openat(2).
+type osDir struct {
+	fd   int
+	name string
+}
+
+// OpenOSDir opens the directory at path of the operating system.
+func OpenOSDir(path string) (Dir, error) {
+	fd, err := ignoringEINTR(func() (int, error) {
+		return syscall.Open(path, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: err}
+	}
+	return &osDir{fd: fd, name: path}, nil
+}
+
+func (d *osDir) ReadFile(name string, buf []byte) ([]byte, error) {
+	fd, err := ignoringEINTR(func() (int, error) {
+		return syscall.Openat(d.fd, name, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	})
+	if err != nil {
+		return buf, &fs.PathError{Op: "openat", Path: d.name + "/" + name, Err: err}
+	}
+	defer syscall.Close(fd)
+	for {
+		if len(buf) == cap(buf) {
+			buf = append(buf, 0)[:len(buf)]
+		}
+		n, err := ignoringEINTR(func() (int, error) {
+			return syscall.Read(fd, buf[len(buf):cap(buf)])
+		})
+		if err != nil {
+			return buf, &fs.PathError{Op: "read", Path: d.name + "/" + name, Err: err}
+		}
+		if n == 0 {
+			return buf, nil
+		}
+		buf = buf[:len(buf)+n]
+	}
+}
+
+func (d *osDir) Close() error {
+	return syscall.Close(d.fd)
+}
+
+func ignoringEINTR(f func() (int, error)) (int, error) {
+	for {
+		n, err := f()
+		if !errors.Is(err, syscall.EINTR) {
+			return n, err
+		}
+	}
+}
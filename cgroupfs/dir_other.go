@@ -0,0 +1,22 @@
+//go:build !linux
+
+package cgroupfs
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// OpenOSDir opens the directory at path of the operating system. Without
+// openat(2), its files are opened by their path.
+func OpenOSDir(path string) (Dir, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: syscall.ENOTDIR}
+	}
+	return fsDir{fsys: os.DirFS(path), dir: "."}, nil
+}
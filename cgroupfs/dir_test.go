@@ -0,0 +1,70 @@
+package cgroupfs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpenDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "system.slice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "system.slice", "memory.current"), []byte("4096\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	osDir, err := OpenOSDir(filepath.Join(dir, "system.slice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer osDir.Close()
+	fsDir, err := OpenDir(fstest.MapFS{
+		"system.slice/memory.current": &fstest.MapFile{Data: []byte("4096\n")},
+	}, "system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsDir.Close()
+
+	for name, d := range map[string]Dir{"os": osDir, "fs": fsDir} {
+		buf, err := d.ReadFile("memory.current", make([]byte, 0, 2))
+		if err != nil || string(buf) != "4096\n" {
+			t.Errorf("%s: expected 4096 got %q, %v", name, buf, err)
+		}
+		if _, err := d.ReadFile("memory.max", nil); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected memory.max to not exist got %v", name, err)
+		}
+	}
+
+	if _, err := OpenOSDir(filepath.Join(dir, "user.slice")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected user.slice to not exist got %v", err)
+	}
+}
+
+func BenchmarkReadFile(b *testing.B) {
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "memory.current"), []byte("4096\n"), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	osDir, err := OpenOSDir(dir)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer osDir.Close()
+	fsDir, _ := OpenDir(os.DirFS(dir), ".")
+	for name, d := range map[string]Dir{"openat": osDir, "open": fsDir} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			buf := make([]byte, 0, 4096)
+			for range b.N {
+				if buf, err = d.ReadFile("memory.current", buf[:0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
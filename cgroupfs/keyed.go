@@ -0,0 +1,145 @@
+package cgroupfs
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// KVVisitor visits a key-value pair of a file.
+type KVVisitor func(k, v string) error
+
+// EntryVisitor visits the key of a line of a nested-keyed file and returns the
+// visitor of its key-value pairs.
+type EntryVisitor func(n string) (KVVisitor, error)
+
+// bytesKVVisitor is a KVVisitor of the keys and values as slices of the file,
+// which are only valid during the call.
+type bytesKVVisitor func(k, v []byte) error
+
+// VisitNestedKeyed parses the file b into nested key-values. The format is
+// expected to be:
+//
+//	KEY0 SUB_KEY0=VAL00 SUB_KEY1=VAL01\n
+//	KEY1 SUB_KEY0=VAL10 SUB_KEY1=VAL11\n
+//	...
+func VisitNestedKeyed(b []byte, visitEntry EntryVisitor) error {
+	return visitNestedKeyed(b, func(n []byte) (bytesKVVisitor, error) {
+		visitKV, err := visitEntry(string(n))
+		if err != nil {
+			return nil, err
+		}
+		return func(k, v []byte) error {
+			return visitKV(string(k), string(v))
+		}, nil
+	})
+}
+
+// visitNestedKeyed is VisitNestedKeyed without copying the keys and values
+// of b.
+func visitNestedKeyed(b []byte, visitEntry func(n []byte) (bytesKVVisitor, error)) error {
+	for len(b) > 0 {
+		var line []byte
+		line, b, _ = bytes.Cut(b, []byte("\n"))
+		k, vs, _ := bytes.Cut(bytes.TrimSpace(line), []byte(" "))
+		visitKV, err := visitEntry(k)
+		if err != nil {
+			return err
+		}
+		for len(vs) > 0 {
+			var v []byte
+			v, vs, _ = bytes.Cut(vs, []byte(" "))
+			key, value, ok := bytes.Cut(v, []byte("="))
+			if !ok || bytes.IndexByte(value, '=') >= 0 {
+				return fmt.Errorf("invalid key-value pair %q %q", k, v)
+			}
+			if err := visitKV(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VisitFlatKeyed parses the file b into key-values. The format is expected to
+// be:
+//
+//	KEY0 VAL0\n
+//	KEY1 VAL1\n
+func VisitFlatKeyed(b []byte, visitKV KVVisitor) error {
+	return visitFlatKeyed(b, func(k, v []byte) error {
+		return visitKV(string(k), string(v))
+	})
+}
+
+// visitFlatKeyed is VisitFlatKeyed without copying the keys and values of b.
+func visitFlatKeyed(b []byte, visitKV bytesKVVisitor) error {
+	for len(b) > 0 {
+		var line []byte
+		line, b, _ = bytes.Cut(b, []byte("\n"))
+		k, v, ok := bytes.Cut(line, []byte(" "))
+		if !ok || bytes.IndexByte(v, ' ') >= 0 {
+			return fmt.Errorf("invalid key-value pair %q", line)
+		}
+		if err := visitKV(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field is a key of a keyed file and the field of T it is parsed into.
+type field[T any] struct {
+	key   string
+	value func(*T) *uint64
+}
+
+// fields are the keys of a keyed file parsed into T. At most 64 keys are
+// supported, as the keys found in a file are kept in a bit set.
+type fields[T any] struct {
+	list  []field[T]
+	index map[string]int
+}
+
+func newFields[T any](list ...field[T]) fields[T] {
+	if len(list) > 64 {
+		panic("cgroupfs: too many fields")
+	}
+	f := fields[T]{list: list, index: make(map[string]int, len(list))}
+	for i, field := range list {
+		f.index[field.key] = i
+	}
+	return f
+}
+
+// set parses the value v of key into s, and records key in present. Unknown
+// keys are skipped.
+func (f fields[T]) set(s *T, present *uint64, k, v []byte) error {
+	i, ok := f.index[string(k)]
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseUint(string(v), 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse value %q of %s: %w", v, k, err)
+	}
+	*f.list[i].value(s) = value
+	*present |= 1 << i
+	return nil
+}
+
+// parse parses the flat-keyed file b into s.
+func (f fields[T]) parse(b []byte, s *T, present *uint64) error {
+	return visitFlatKeyed(b, func(k, v []byte) error {
+		return f.set(s, present, k, v)
+	})
+}
+
+// value returns the value of key in s, and whether it was found in the file.
+func (f fields[T]) value(s *T, present uint64, key string) (uint64, bool) {
+	i, ok := f.index[key]
+	if !ok || present&(1<<i) == 0 {
+		return 0, false
+	}
+	return *f.list[i].value(s), true
+}
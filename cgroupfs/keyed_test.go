@@ -0,0 +1,39 @@
+package cgroupfs
+
+import (
+	"testing"
+)
+
+func TestVisitFlatKeyed(t *testing.T) {
+	got := make(map[string]string)
+	err := VisitFlatKeyed([]byte("low 0\nhigh 12\n"), func(k, v string) error {
+		got[k] = v
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["low"] != "0" || got["high"] != "12" {
+		t.Errorf("expected low=0 high=12 got %v", got)
+	}
+	if err := VisitFlatKeyed([]byte("low 0 1\n"), func(k, v string) error { return nil }); err == nil {
+		t.Error("expected error for invalid line")
+	}
+}
+
+func TestVisitNestedKeyed(t *testing.T) {
+	got := make(map[string]string)
+	err := VisitNestedKeyed([]byte("8:0 rbytes=1 wbytes=2\n8:16\n"), func(n string) (KVVisitor, error) {
+		got[n] = ""
+		return func(k, v string) error {
+			got[n] += k + "=" + v + " "
+			return nil
+		}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["8:0"] != "rbytes=1 wbytes=2 " || got["8:16"] != "" {
+		t.Errorf("unexpected entries %v", got)
+	}
+}
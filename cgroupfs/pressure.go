@@ -0,0 +1,59 @@
+package cgroupfs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PSIStats are the pressure stall information of a line of a pressure file.
+type PSIStats struct {
+	// Avg10, Avg60 and Avg300 are the percentages of time stalled over the
+	// last 10, 60 and 300 seconds.
+	Avg10, Avg60, Avg300 float64
+	// Total is the total time stalled in microseconds.
+	Total uint64
+}
+
+// PSI is a pressure file, like cpu.pressure: the time some tasks and all
+// tasks of the cgroup were stalled on the resource.
+type PSI struct {
+	Some PSIStats
+	// Full is nil if the file doesn't report it, like cpu.pressure before
+	// Linux 5.13.
+	Full *PSIStats
+}
+
+// ParsePSI parses a pressure file.
+func ParsePSI(b []byte) (PSI, error) {
+	var psi PSI
+	err := visitNestedKeyed(b, func(n []byte) (bytesKVVisitor, error) {
+		var s *PSIStats
+		switch string(n) {
+		case "some":
+			s = &psi.Some
+		case "full":
+			psi.Full = new(PSIStats)
+			s = psi.Full
+		default:
+			return nil, fmt.Errorf("unknown pressure type %q", n)
+		}
+		return func(k, v []byte) error {
+			var err error
+			switch string(k) {
+			case "avg10":
+				s.Avg10, err = strconv.ParseFloat(string(v), 64)
+			case "avg60":
+				s.Avg60, err = strconv.ParseFloat(string(v), 64)
+			case "avg300":
+				s.Avg300, err = strconv.ParseFloat(string(v), 64)
+			case "total":
+				s.Total, err = strconv.ParseUint(string(v), 10, 64)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse value %q of %s: %w", v, k, err)
+			}
+			return nil
+		}, nil
+	})
+	return psi, err
+}
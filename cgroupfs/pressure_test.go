@@ -0,0 +1,33 @@
+package cgroupfs
+
+import (
+	"testing"
+)
+
+func TestParsePSI(t *testing.T) {
+	psi, err := ParsePSI([]byte(`some avg10=0.08 avg60=0.03 avg300=0.06 total=7113021
+full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := PSIStats{Avg10: 0.08, Avg60: 0.03, Avg300: 0.06, Total: 7113021}
+	if psi.Some != expected {
+		t.Errorf("expected %+v got %+v", expected, psi.Some)
+	}
+	if psi.Full == nil || *psi.Full != (PSIStats{}) {
+		t.Errorf("expected zero full got %+v", psi.Full)
+	}
+
+	psi, err = ParsePSI([]byte("some avg10=0.00 avg60=0.00 avg300=0.00 total=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if psi.Full != nil {
+		t.Errorf("expected no full got %+v", psi.Full)
+	}
+
+	if _, err := ParsePSI([]byte("most avg10=0.00\n")); err == nil {
+		t.Error("expected error for unknown pressure type")
+	}
+}
@@ -0,0 +1,283 @@
+package cgroupfs
+
+// CPUStat is cpu.stat. Times are in microseconds, like in the file. Keys the
+// kernel doesn't report, like those of the cpu controller when it is not
+// enabled, are zero; Value tells them apart.
+type CPUStat struct {
+	UsageUsec              uint64
+	UserUsec               uint64
+	SystemUsec             uint64
+	NrPeriods              uint64
+	NrThrottled            uint64
+	ThrottledUsec          uint64
+	NrBursts               uint64
+	BurstUsec              uint64
+	CoreSchedForceIdleUsec uint64
+
+	present uint64
+}
+
+var cpuStatFields = newFields(
+	field[CPUStat]{"usage_usec", func(s *CPUStat) *uint64 { return &s.UsageUsec }},
+	field[CPUStat]{"user_usec", func(s *CPUStat) *uint64 { return &s.UserUsec }},
+	field[CPUStat]{"system_usec", func(s *CPUStat) *uint64 { return &s.SystemUsec }},
+	field[CPUStat]{"nr_periods", func(s *CPUStat) *uint64 { return &s.NrPeriods }},
+	field[CPUStat]{"nr_throttled", func(s *CPUStat) *uint64 { return &s.NrThrottled }},
+	field[CPUStat]{"throttled_usec", func(s *CPUStat) *uint64 { return &s.ThrottledUsec }},
+	field[CPUStat]{"nr_bursts", func(s *CPUStat) *uint64 { return &s.NrBursts }},
+	field[CPUStat]{"burst_usec", func(s *CPUStat) *uint64 { return &s.BurstUsec }},
+	field[CPUStat]{"core_sched.force_idle_usec", func(s *CPUStat) *uint64 { return &s.CoreSchedForceIdleUsec }},
+)
+
+// ParseCPUStat parses cpu.stat.
+func ParseCPUStat(b []byte) (CPUStat, error) {
+	var s CPUStat
+	err := cpuStatFields.parse(b, &s, &s.present)
+	return s, err
+}
+
+// Value returns the value of the key of cpu.stat, and whether the file has
+// the key.
+func (s *CPUStat) Value(key string) (uint64, bool) {
+	return cpuStatFields.value(s, s.present, key)
+}
+
+// MemoryStat is memory.stat. Amounts of memory are in bytes, the other
+// values are numbers of events or pages.
+type MemoryStat struct {
+	Anon                   uint64
+	File                   uint64
+	Kernel                 uint64
+	KernelStack            uint64
+	Pagetables             uint64
+	SecPagetables          uint64
+	Percpu                 uint64
+	Sock                   uint64
+	Vmalloc                uint64
+	Shmem                  uint64
+	Zswap                  uint64
+	Zswapped               uint64
+	FileMapped             uint64
+	FileDirty              uint64
+	FileWriteback          uint64
+	Swapcached             uint64
+	AnonTHP                uint64
+	FileTHP                uint64
+	ShmemTHP               uint64
+	InactiveAnon           uint64
+	ActiveAnon             uint64
+	InactiveFile           uint64
+	ActiveFile             uint64
+	Unevictable            uint64
+	SlabReclaimable        uint64
+	SlabUnreclaimable      uint64
+	Slab                   uint64
+	WorkingsetRefaultAnon  uint64
+	WorkingsetRefaultFile  uint64
+	WorkingsetActivateAnon uint64
+	WorkingsetActivateFile uint64
+	WorkingsetRestoreAnon  uint64
+	WorkingsetRestoreFile  uint64
+	WorkingsetNodereclaim  uint64
+	Pgscan                 uint64
+	Pgsteal                uint64
+	PgscanKswapd           uint64
+	PgscanDirect           uint64
+	PgscanKhugepaged       uint64
+	PgstealKswapd          uint64
+	PgstealDirect          uint64
+	PgstealKhugepaged      uint64
+	Pgfault                uint64
+	Pgmajfault             uint64
+	Pgrefill               uint64
+	Pgactivate             uint64
+	Pgdeactivate           uint64
+	Pglazyfree             uint64
+	Pglazyfreed            uint64
+	Zswpin                 uint64
+	Zswpout                uint64
+	Zswpwb                 uint64
+	THPFaultAlloc          uint64
+	THPCollapseAlloc       uint64
+	THPSwpout              uint64
+	THPSwpoutFallback      uint64
+
+	present uint64
+}
+
+var memoryStatFields = newFields(
+	field[MemoryStat]{"anon", func(s *MemoryStat) *uint64 { return &s.Anon }},
+	field[MemoryStat]{"file", func(s *MemoryStat) *uint64 { return &s.File }},
+	field[MemoryStat]{"kernel", func(s *MemoryStat) *uint64 { return &s.Kernel }},
+	field[MemoryStat]{"kernel_stack", func(s *MemoryStat) *uint64 { return &s.KernelStack }},
+	field[MemoryStat]{"pagetables", func(s *MemoryStat) *uint64 { return &s.Pagetables }},
+	field[MemoryStat]{"sec_pagetables", func(s *MemoryStat) *uint64 { return &s.SecPagetables }},
+	field[MemoryStat]{"percpu", func(s *MemoryStat) *uint64 { return &s.Percpu }},
+	field[MemoryStat]{"sock", func(s *MemoryStat) *uint64 { return &s.Sock }},
+	field[MemoryStat]{"vmalloc", func(s *MemoryStat) *uint64 { return &s.Vmalloc }},
+	field[MemoryStat]{"shmem", func(s *MemoryStat) *uint64 { return &s.Shmem }},
+	field[MemoryStat]{"zswap", func(s *MemoryStat) *uint64 { return &s.Zswap }},
+	field[MemoryStat]{"zswapped", func(s *MemoryStat) *uint64 { return &s.Zswapped }},
+	field[MemoryStat]{"file_mapped", func(s *MemoryStat) *uint64 { return &s.FileMapped }},
+	field[MemoryStat]{"file_dirty", func(s *MemoryStat) *uint64 { return &s.FileDirty }},
+	field[MemoryStat]{"file_writeback", func(s *MemoryStat) *uint64 { return &s.FileWriteback }},
+	field[MemoryStat]{"swapcached", func(s *MemoryStat) *uint64 { return &s.Swapcached }},
+	field[MemoryStat]{"anon_thp", func(s *MemoryStat) *uint64 { return &s.AnonTHP }},
+	field[MemoryStat]{"file_thp", func(s *MemoryStat) *uint64 { return &s.FileTHP }},
+	field[MemoryStat]{"shmem_thp", func(s *MemoryStat) *uint64 { return &s.ShmemTHP }},
+	field[MemoryStat]{"inactive_anon", func(s *MemoryStat) *uint64 { return &s.InactiveAnon }},
+	field[MemoryStat]{"active_anon", func(s *MemoryStat) *uint64 { return &s.ActiveAnon }},
+	field[MemoryStat]{"inactive_file", func(s *MemoryStat) *uint64 { return &s.InactiveFile }},
+	field[MemoryStat]{"active_file", func(s *MemoryStat) *uint64 { return &s.ActiveFile }},
+	field[MemoryStat]{"unevictable", func(s *MemoryStat) *uint64 { return &s.Unevictable }},
+	field[MemoryStat]{"slab_reclaimable", func(s *MemoryStat) *uint64 { return &s.SlabReclaimable }},
+	field[MemoryStat]{"slab_unreclaimable", func(s *MemoryStat) *uint64 { return &s.SlabUnreclaimable }},
+	field[MemoryStat]{"slab", func(s *MemoryStat) *uint64 { return &s.Slab }},
+	field[MemoryStat]{"workingset_refault_anon", func(s *MemoryStat) *uint64 { return &s.WorkingsetRefaultAnon }},
+	field[MemoryStat]{"workingset_refault_file", func(s *MemoryStat) *uint64 { return &s.WorkingsetRefaultFile }},
+	field[MemoryStat]{"workingset_activate_anon", func(s *MemoryStat) *uint64 { return &s.WorkingsetActivateAnon }},
+	field[MemoryStat]{"workingset_activate_file", func(s *MemoryStat) *uint64 { return &s.WorkingsetActivateFile }},
+	field[MemoryStat]{"workingset_restore_anon", func(s *MemoryStat) *uint64 { return &s.WorkingsetRestoreAnon }},
+	field[MemoryStat]{"workingset_restore_file", func(s *MemoryStat) *uint64 { return &s.WorkingsetRestoreFile }},
+	field[MemoryStat]{"workingset_nodereclaim", func(s *MemoryStat) *uint64 { return &s.WorkingsetNodereclaim }},
+	field[MemoryStat]{"pgscan", func(s *MemoryStat) *uint64 { return &s.Pgscan }},
+	field[MemoryStat]{"pgsteal", func(s *MemoryStat) *uint64 { return &s.Pgsteal }},
+	field[MemoryStat]{"pgscan_kswapd", func(s *MemoryStat) *uint64 { return &s.PgscanKswapd }},
+	field[MemoryStat]{"pgscan_direct", func(s *MemoryStat) *uint64 { return &s.PgscanDirect }},
+	field[MemoryStat]{"pgscan_khugepaged", func(s *MemoryStat) *uint64 { return &s.PgscanKhugepaged }},
+	field[MemoryStat]{"pgsteal_kswapd", func(s *MemoryStat) *uint64 { return &s.PgstealKswapd }},
+	field[MemoryStat]{"pgsteal_direct", func(s *MemoryStat) *uint64 { return &s.PgstealDirect }},
+	field[MemoryStat]{"pgsteal_khugepaged", func(s *MemoryStat) *uint64 { return &s.PgstealKhugepaged }},
+	field[MemoryStat]{"pgfault", func(s *MemoryStat) *uint64 { return &s.Pgfault }},
+	field[MemoryStat]{"pgmajfault", func(s *MemoryStat) *uint64 { return &s.Pgmajfault }},
+	field[MemoryStat]{"pgrefill", func(s *MemoryStat) *uint64 { return &s.Pgrefill }},
+	field[MemoryStat]{"pgactivate", func(s *MemoryStat) *uint64 { return &s.Pgactivate }},
+	field[MemoryStat]{"pgdeactivate", func(s *MemoryStat) *uint64 { return &s.Pgdeactivate }},
+	field[MemoryStat]{"pglazyfree", func(s *MemoryStat) *uint64 { return &s.Pglazyfree }},
+	field[MemoryStat]{"pglazyfreed", func(s *MemoryStat) *uint64 { return &s.Pglazyfreed }},
+	field[MemoryStat]{"zswpin", func(s *MemoryStat) *uint64 { return &s.Zswpin }},
+	field[MemoryStat]{"zswpout", func(s *MemoryStat) *uint64 { return &s.Zswpout }},
+	field[MemoryStat]{"zswpwb", func(s *MemoryStat) *uint64 { return &s.Zswpwb }},
+	field[MemoryStat]{"thp_fault_alloc", func(s *MemoryStat) *uint64 { return &s.THPFaultAlloc }},
+	field[MemoryStat]{"thp_collapse_alloc", func(s *MemoryStat) *uint64 { return &s.THPCollapseAlloc }},
+	field[MemoryStat]{"thp_swpout", func(s *MemoryStat) *uint64 { return &s.THPSwpout }},
+	field[MemoryStat]{"thp_swpout_fallback", func(s *MemoryStat) *uint64 { return &s.THPSwpoutFallback }},
+)
+
+// ParseMemoryStat parses memory.stat.
+func ParseMemoryStat(b []byte) (MemoryStat, error) {
+	var s MemoryStat
+	err := memoryStatFields.parse(b, &s, &s.present)
+	return s, err
+}
+
+// Value returns the value of the key of memory.stat, and whether the file has
+// the key.
+func (s *MemoryStat) Value(key string) (uint64, bool) {
+	return memoryStatFields.value(s, s.present, key)
+}
+
+// MemoryEvents is memory.events, the number of times the memory of the
+// cgroup hit its boundaries.
+type MemoryEvents struct {
+	Low          uint64
+	High         uint64
+	Max          uint64
+	Oom          uint64
+	OomKill      uint64
+	OomGroupKill uint64
+
+	present uint64
+}
+
+var memoryEventsFields = newFields(
+	field[MemoryEvents]{"low", func(s *MemoryEvents) *uint64 { return &s.Low }},
+	field[MemoryEvents]{"high", func(s *MemoryEvents) *uint64 { return &s.High }},
+	field[MemoryEvents]{"max", func(s *MemoryEvents) *uint64 { return &s.Max }},
+	field[MemoryEvents]{"oom", func(s *MemoryEvents) *uint64 { return &s.Oom }},
+	field[MemoryEvents]{"oom_kill", func(s *MemoryEvents) *uint64 { return &s.OomKill }},
+	field[MemoryEvents]{"oom_group_kill", func(s *MemoryEvents) *uint64 { return &s.OomGroupKill }},
+)
+
+// ParseMemoryEvents parses memory.events.
+func ParseMemoryEvents(b []byte) (MemoryEvents, error) {
+	var s MemoryEvents
+	err := memoryEventsFields.parse(b, &s, &s.present)
+	return s, err
+}
+
+// Value returns the value of the key of memory.events, and whether the file has
+// the key.
+func (s *MemoryEvents) Value(key string) (uint64, bool) {
+	return memoryEventsFields.value(s, s.present, key)
+}
+
+// PidsEvents is pids.events.
+type PidsEvents struct {
+	Max uint64
+
+	present uint64
+}
+
+var pidsEventsFields = newFields(
+	field[PidsEvents]{"max", func(s *PidsEvents) *uint64 { return &s.Max }},
+)
+
+// ParsePidsEvents parses pids.events.
+func ParsePidsEvents(b []byte) (PidsEvents, error) {
+	var s PidsEvents
+	err := pidsEventsFields.parse(b, &s, &s.present)
+	return s, err
+}
+
+// Value returns the value of the key of pids.events, and whether the file has
+// the key.
+func (s *PidsEvents) Value(key string) (uint64, bool) {
+	return pidsEventsFields.value(s, s.present, key)
+}
+
+// IOStat is the line of io.stat of a device.
+type IOStat struct {
+	// Device is the number of the device, MAJ:MIN.
+	Device string
+	RBytes uint64
+	WBytes uint64
+	RIOs   uint64
+	WIOs   uint64
+	DBytes uint64
+	DIOs   uint64
+
+	present uint64
+}
+
+var ioStatFields = newFields(
+	field[IOStat]{"rbytes", func(s *IOStat) *uint64 { return &s.RBytes }},
+	field[IOStat]{"wbytes", func(s *IOStat) *uint64 { return &s.WBytes }},
+	field[IOStat]{"rios", func(s *IOStat) *uint64 { return &s.RIOs }},
+	field[IOStat]{"wios", func(s *IOStat) *uint64 { return &s.WIOs }},
+	field[IOStat]{"dbytes", func(s *IOStat) *uint64 { return &s.DBytes }},
+	field[IOStat]{"dios", func(s *IOStat) *uint64 { return &s.DIOs }},
+)
+
+// ParseIOStat parses io.stat. Devices without any I/O have no values.
+func ParseIOStat(b []byte) ([]IOStat, error) {
+	var stats []IOStat
+	err := visitNestedKeyed(b, func(n []byte) (bytesKVVisitor, error) {
+		if len(n) == 0 {
+			// blank lines
+			return func(k, v []byte) error { return nil }, nil
+		}
+		stats = append(stats, IOStat{Device: string(n)})
+		s := &stats[len(stats)-1]
+		return func(k, v []byte) error {
+			return ioStatFields.set(s, &s.present, k, v)
+		}, nil
+	})
+	return stats, err
+}
+
+// Value returns the value of the key of the line of io.stat, and whether the
+// line has the key.
+func (s *IOStat) Value(key string) (uint64, bool) {
+	return ioStatFields.value(s, s.present, key)
+}
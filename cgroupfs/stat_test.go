@@ -0,0 +1,86 @@
+package cgroupfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCPUStat(t *testing.T) {
+	s, err := ParseCPUStat([]byte("usage_usec 300\nuser_usec 200\nsystem_usec 100\nunknown_key x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UsageUsec != 300 || s.UserUsec != 200 || s.SystemUsec != 100 {
+		t.Errorf("unexpected %+v", s)
+	}
+	if v, ok := s.Value("usage_usec"); !ok || v != 300 {
+		t.Errorf("expected usage_usec 300 got %d, %t", v, ok)
+	}
+	// the cpu controller is not enabled
+	if _, ok := s.Value("nr_periods"); ok {
+		t.Error("expected nr_periods to be missing")
+	}
+	if _, ok := s.Value("unknown_key"); ok {
+		t.Error("expected unknown keys to be skipped")
+	}
+
+	if _, err := ParseCPUStat([]byte("usage_usec lots\n")); err == nil {
+		t.Error("expected error for invalid value")
+	}
+}
+
+func TestParseMemoryStat(t *testing.T) {
+	s, err := ParseMemoryStat([]byte("anon 4096\nfile 8192\nanon_thp 0\npgfault 12\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Anon != 4096 || s.File != 8192 || s.Pgfault != 12 {
+		t.Errorf("unexpected %+v", s)
+	}
+	if _, ok := s.Value("anon_thp"); !ok {
+		t.Error("expected anon_thp")
+	}
+	if _, ok := s.Value("shmem"); ok {
+		t.Error("expected shmem to be missing")
+	}
+}
+
+func TestParseIOStat(t *testing.T) {
+	iostat := `
+7:7 
+254:0 rbytes=4235943936 wbytes=37844828160 rios=72223 wios=2392288 dbytes=0 dios=0
+`
+	stats, err := ParseIOStat([]byte(iostat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 devices got %+v", stats)
+	}
+	if stats[0].Device != "7:7" {
+		t.Errorf("expected 7:7 got %s", stats[0].Device)
+	}
+	if _, ok := stats[0].Value("rbytes"); ok {
+		t.Error("expected no values for 7:7")
+	}
+	if stats[1].Device != "254:0" || stats[1].RBytes != 4235943936 || stats[1].WIOs != 2392288 {
+		t.Errorf("unexpected %+v", stats[1])
+	}
+	if v, ok := stats[1].Value("dbytes"); !ok || v != 0 {
+		t.Errorf("expected dbytes 0 got %d, %t", v, ok)
+	}
+}
+
+func BenchmarkParseMemoryStat(b *testing.B) {
+	var memoryStat strings.Builder
+	for _, f := range memoryStatFields.list {
+		memoryStat.WriteString(f.key + " 123456789\n")
+	}
+	s := []byte(memoryStat.String())
+	b.ReportAllocs()
+	for range b.N {
+		if _, err := ParseMemoryStat(s); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Schedule is how often the cgroups matching Match and their descendants are
+// collected in the background. The schedule matching the nearest ancestor of
+// a cgroup wins.
+type Schedule struct {
+	Match    string   `json:"match"`
+	Interval Duration `json:"interval"`
+}
+
+func (s Schedule) validate() error {
+	if err := ValidatePattern(s.Match); err != nil {
+		return fmt.Errorf("invalid match %q: %w", s.Match, err)
+	}
+	if s.Interval <= 0 {
+		return fmt.Errorf("interval of %q must be positive", s.Match)
+	}
+	return nil
+}
+
+// background collects the cgroups on a schedule and keeps the latest metrics
+// of each, which are served by Collect.
+type background struct {
+	ctx context.Context
+	// matches and intervals are those of the schedules, followed by the
+	// default interval, which has no match.
+	matches   []pattern
+	intervals []time.Duration
+	// files are the keys of the files of the descriptors, to filter the
+	// snapshot by file.
+	files map[*prometheus.Desc]string
+	ready chan struct{}
+
+	mu        sync.Mutex
+	snapshots []snapshot
+	duration  time.Duration
+	cgroups   int
+}
+
+// snapshot are the metrics of the cgroups of a schedule, as last collected.
+type snapshot struct {
+	cgroups []*cgroupEntry
+	metrics map[*cgroupEntry][]prometheus.Metric
+}
+
+// start collects the cgroups of c in the background until the context is
+// done.
+func (b *background) start(c *cgroupCollector) {
+	b.files = make(map[*prometheus.Desc]string)
+	singleTables := []map[string]collector{c.singleCollectors}
+	multipleTables := []map[string]multipleCollector{c.multipleCollectors}
+	for _, p := range c.profiles {
+		singleTables = append(singleTables, p.singleCollectors)
+		multipleTables = append(multipleTables, p.multipleCollectors)
+	}
+	for _, table := range singleTables {
+		for file, col := range table {
+			b.files[col.desc] = file
+		}
+	}
+	for _, table := range multipleTables {
+		for file, col := range table {
+			for _, d := range col.descs {
+				b.files[d.desc] = file
+			}
+		}
+	}
+	go b.run(c)
+}
+
+// run collects the cgroups whose schedule is due, until the context is done.
+func (b *background) run(c *cgroupCollector) {
+	next := make([]time.Time, len(b.intervals))
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-timer.C:
+		}
+		now := time.Now()
+		due := make([]bool, len(b.intervals))
+		earliest := time.Time{}
+		for i, interval := range b.intervals {
+			if !now.Before(next[i]) {
+				due[i] = true
+				next[i] = now.Add(interval)
+			}
+			if earliest.IsZero() || next[i].Before(earliest) {
+				earliest = next[i]
+			}
+		}
+		c.refresh(due)
+		select {
+		case <-b.ready:
+		default:
+			close(b.ready)
+		}
+		timer.Reset(time.Until(earliest))
+	}
+}
+
+// schedule returns the index of the schedule of the cgroup.
+func (b *background) schedule(cgroup string) int {
+	best, bestDepth := len(b.matches), -1
+	for i, match := range b.matches {
+		for dir, d := cgroup, depth(cgroup); d > bestDepth; dir, d = path.Dir(dir), d-1 {
+			if match.match(dir) {
+				best, bestDepth = i, d
+				break
+			}
+		}
+	}
+	return best
+}
+
+// due reports whether the schedule of the cgroup at path is due. The members
+// of a rollup follow the schedule of the rollup.
+func (c *cgroupCollector) due(due []bool, path string) bool {
+	if c.rollups != nil {
+		if name, ok := c.rollups.match(path); ok {
+			path = name
+		}
+	}
+	return due[c.background.schedule(path)]
+}
+
+// dueBelow reports whether the schedule of a cgroup below path may be due,
+// so path has to be walked.
+func (c *cgroupCollector) dueBelow(due []bool, path string) bool {
+	if c.rollups != nil {
+		if _, ok := c.rollups.match(path); ok {
+			// the cgroups below the members of a rollup are not collected
+			return false
+		}
+	}
+	for i, match := range c.background.matches {
+		if due[i] && match.matchBelow(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh collects the cgroups of the due schedules and replaces their
+// snapshots. The samples are timestamped with the time they were collected.
+// The subtrees of the schedules that are not due are not walked.
+func (c *cgroupCollector) refresh(due []bool) {
+	b := c.background
+	start := time.Now()
+	s := c.scan(due)
+	cgroups := make([][]*cgroupEntry, len(due))
+	for _, cgroup := range s.order {
+		if i := b.schedule(cgroup.path); due[i] {
+			cgroups[i] = append(cgroups[i], cgroup)
+		}
+	}
+	snapshots := make(map[int]snapshot)
+	for i := range due {
+		if !due[i] {
+			continue
+		}
+		now := time.Now()
+		snapshot := snapshot{cgroups: cgroups[i], metrics: make(map[*cgroupEntry][]prometheus.Metric, len(cgroups[i]))}
+		for j, metrics := range c.gatherCgroups(cgroups[i]) {
+			for k, metric := range metrics {
+				metrics[k] = prometheus.NewMetricWithTimestamp(now, metric)
+			}
+			snapshot.metrics[cgroups[i][j]] = metrics
+		}
+		snapshots[i] = snapshot
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.snapshots == nil {
+		b.snapshots = make([]snapshot, len(due))
+	}
+	// the cgroups of the schedules that are not due were not looked for, so
+	// their state is kept as of their last collection
+	for i, snapshot := range b.snapshots {
+		if due[i] {
+			continue
+		}
+		for _, cgroup := range snapshot.cgroups {
+			if cgroup.members == nil {
+				s.cgroups[cgroup.path] = cgroup
+				continue
+			}
+			s.rollups[cgroup.path] = true
+			for _, member := range cgroup.members {
+				s.cgroups[member.path] = member
+			}
+		}
+	}
+	c.forget(s)
+	for i, snapshot := range snapshots {
+		b.snapshots[i] = snapshot
+	}
+	b.duration = time.Since(start)
+	b.cgroups = len(s.cgroups)
+}
+
+// collectSnapshot exports the latest metrics collected in the background,
+// waiting for the first collection. The filters of c, the cardinality limits
+// and the self metrics apply as if the cgroups were collected now.
+func (c *cgroupCollector) collectSnapshot(m chan<- prometheus.Metric) {
+	b := c.background
+	var done <-chan struct{}
+	if c.deadline != nil {
+		done = c.deadline.ctx.Done()
+	}
+	select {
+	case <-b.ready:
+	case <-b.ctx.Done():
+	case <-done:
+		c.deadline.expired()
+	}
+	b.mu.Lock()
+	var cgroups []*cgroupEntry
+	metrics := make(map[*cgroupEntry][]prometheus.Metric)
+	for _, snapshot := range b.snapshots {
+		for _, cgroup := range snapshot.cgroups {
+			if !c.filterIncluded(cgroup.path) {
+				continue
+			}
+			cgroups = append(cgroups, cgroup)
+			metrics[cgroup] = snapshot.metrics[cgroup]
+		}
+	}
+	duration, scanned := b.duration, b.cgroups
+	b.mu.Unlock()
+
+	gatherCgroups := func(cgroups []*cgroupEntry) [][]prometheus.Metric {
+		gathered := make([][]prometheus.Metric, len(cgroups))
+		for i, cgroup := range cgroups {
+			for _, metric := range metrics[cgroup] {
+				if file, ok := b.files[metric.Desc()]; !ok || c.collect == nil || c.collect[file] {
+					gathered[i] = append(gathered[i], metric)
+				}
+			}
+		}
+		return gathered
+	}
+	if c.limits != nil {
+		c.limits.collect(cgroups, len(cgroups), gatherCgroups, m)
+	} else {
+		for _, metrics := range gatherCgroups(cgroups) {
+			for _, metric := range metrics {
+				m <- metric
+			}
+		}
+	}
+	if c.selfMetrics {
+		c.stats.collect(duration, scanned, c.deadline.wasTruncated(), m)
+	}
+}
+
+// filterIncluded reports whether the cgroup or one of its ancestors matches
+// the patterns c is filtered with, if any.
+func (c *cgroupCollector) filterIncluded(cgroup string) bool {
+	if len(c.filterIncludes) == 0 {
+		return true
+	}
+	for dir := cgroup; ; dir = path.Dir(dir) {
+		if matchAny(c.filterIncludes, dir) {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// WithBackground collects the cgroups in the background every interval
+// instead of on every scrape, until ctx is done. Scrapes export the latest
+// metrics with the time they were collected. The cgroups matching a schedule
+// and their descendants are collected at the interval of the schedule
+// instead. The first scrape waits for the first collection. Invalid
+// schedules are logged and skipped.
+func WithBackground(ctx context.Context, interval time.Duration, schedules ...Schedule) Option {
+	return func(c *cgroupCollector) {
+		if interval <= 0 {
+			slog.Error("background interval must be positive, collecting on every scrape", "interval", interval)
+			return
+		}
+		b := &background{ctx: ctx, ready: make(chan struct{})}
+		for _, s := range schedules {
+			if err := s.validate(); err != nil {
+				slog.Error("invalid schedule", "match", s.Match, "error", err)
+				continue
+			}
+			b.matches = append(b.matches, strings.Split(s.Match, "/"))
+			b.intervals = append(b.intervals, time.Duration(s.Interval))
+		}
+		b.intervals = append(b.intervals, interval)
+		c.background = b
+	}
+}
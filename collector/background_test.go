@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// countingfs counts the files opened per cgroup.
+type countingfs struct {
+	fs.FS
+
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+func (c *countingfs) Open(name string) (fs.File, error) {
+	if strings.HasSuffix(name, "/memory.current") {
+		c.mu.Lock()
+		c.opens[strings.TrimSuffix(name, "/memory.current")]++
+		c.mu.Unlock()
+	}
+	return c.FS.Open(name)
+}
+
+func (c *countingfs) count(cgroup string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opens[cgroup]
+}
+
+func TestBackground(t *testing.T) {
+	fsys := &countingfs{FS: fstest.MapFS{
+		"system.slice/memory.current":           &fstest.MapFile{Data: []byte("1\n")},
+		"machine.slice/vm.scope/memory.current": &fstest.MapFile{Data: []byte("2\n")},
+	}, opens: make(map[string]int)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(fsys, "", WithBackground(ctx, time.Hour, Schedule{Match: "machine.slice", Interval: Duration(10 * time.Millisecond)}))
+
+	for range 5 {
+		metrics := gather(c.Collect)
+		if len(metrics) != 2 {
+			t.Fatalf("expected 2 metrics got %d", len(metrics))
+		}
+		for _, metric := range metrics {
+			dto := new(io_prometheus_client.Metric)
+			metric.Write(dto)
+			if dto.TimestampMs == nil {
+				t.Errorf("expected a timestamp for %s", metric.Desc())
+			}
+		}
+	}
+	if n := fsys.count("system.slice"); n != 1 {
+		t.Errorf("expected system.slice to be read once got %d", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for fsys.count("machine.slice/vm.scope") < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := fsys.count("machine.slice/vm.scope"); n < 3 {
+		t.Errorf("expected machine.slice/vm.scope to be read on its own schedule got %d reads", n)
+	}
+	if n := fsys.count("system.slice"); n != 1 {
+		t.Errorf("expected system.slice to be read once got %d", n)
+	}
+
+	filtered, err := Filter(c, []string{"machine.slice"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics := gather(filtered.Collect); len(metrics) != 1 {
+		t.Errorf("expected 1 metric below machine.slice got %d", len(metrics))
+	}
+	filtered, err = Filter(c, nil, []string{"memory.max"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics := gather(filtered.Collect); len(metrics) != 0 {
+		t.Errorf("expected no memory.max metrics got %d", len(metrics))
+	}
+}
+
+// readDirCountingfs counts the directories listed.
+type readDirCountingfs struct {
+	fstest.MapFS
+
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (r *readDirCountingfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	r.mu.Lock()
+	r.reads[name]++
+	r.mu.Unlock()
+	return r.MapFS.ReadDir(name)
+}
+
+func (r *readDirCountingfs) count(dir string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads[dir]
+}
+
+func TestBackgroundWalksDueSubtrees(t *testing.T) {
+	fsys := &readDirCountingfs{MapFS: fstest.MapFS{
+		"system.slice/nginx.service/memory.current":     &fstest.MapFile{Data: []byte("1\n")},
+		"user.slice/session-1.scope/cpu.stat":           &fstest.MapFile{Data: []byte("usage_usec 1000000\n")},
+		"user.slice/session-2.scope/cpu.stat":           &fstest.MapFile{Data: []byte("usage_usec 2000000\n")},
+		"machine.slice/machine-vm.scope/memory.current": &fstest.MapFile{Data: []byte("2\n")},
+	}, reads: make(map[string]int)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(fsys, "",
+		WithRollups("user.slice/session-*.scope"),
+		WithBackground(ctx, time.Hour, Schedule{Match: "machine.slice", Interval: Duration(10 * time.Millisecond)}),
+	).(*cgroupCollector)
+
+	gather(c.Collect)
+	deadline := time.Now().Add(5 * time.Second)
+	for fsys.count("machine.slice/machine-vm.scope") < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := fsys.count("machine.slice/machine-vm.scope"); n < 3 {
+		t.Errorf("expected machine.slice to be walked on its own schedule got %d walks", n)
+	}
+	for _, dir := range []string{"system.slice", "system.slice/nginx.service", "user.slice"} {
+		if n := fsys.count(dir); n != 1 {
+			t.Errorf("expected %s to be walked once got %d", dir, n)
+		}
+	}
+	c.rollups.mu.Lock()
+	_, ok := c.rollups.groups["user.slice/session-*.scope"]
+	c.rollups.mu.Unlock()
+	if !ok {
+		t.Error("expected the state of the rollup not due to be kept")
+	}
+	if metrics := gather(c.Collect); len(metrics) != 3 {
+		t.Errorf("expected the 3 metrics of every schedule got %d", len(metrics))
+	}
+}
+
+func TestBackgroundStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := New(fstest.MapFS{}, "", WithBackground(ctx, time.Hour))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gather(c.Collect)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("expected scrapes not to wait once the context is done")
+	}
+}
+
+func TestLoadConfigSchedules(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `{"schedules": [{"match": "machine.slice/*", "interval": "5s"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Schedules) != 1 || config.Schedules[0].Interval != Duration(5*time.Second) {
+		t.Errorf("unexpected schedules %+v", config.Schedules)
+	}
+	for _, invalid := range []string{
+		`{"schedules": [{"match": "machine.slice", "interval": "soon"}]}`,
+		`{"schedules": [{"match": "machine.slice"}]}`,
+		`{"schedules": [{"match": "[", "interval": "5s"}]}`,
+	} {
+		if _, err := LoadConfig(writeConfig(t, invalid)); err == nil {
+			t.Errorf("%s: expected error", invalid)
+		}
+	}
+}
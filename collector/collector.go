@@ -1,25 +1,113 @@
 package collector
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/arianvp/cgroup-exporter/cgroupfs"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type cgroupCollector struct {
 	fs                 fs.FS
 	glob               string
+	includes           []pattern
+	excludes           []pattern
+	maxDepth           int
+	filtered           bool
+	deadline           *deadline
+	filterIncludes     []pattern
+	collect            map[string]bool
+	limits             *limiter
+	rollups            *rollups
+	workers            int
+	stats              *stats
+	selfMetrics        bool
+	errorHandler       func(error)
+	skipUnpopulated    bool
+	unpopulatedInfo    bool
+	labelers           []labeler
+	rewrite            func(cgroup string) string
+	files              map[string]bool
+	profileConfigs     []Profile
+	background         *background
+	fileCollectors     []FileCollector
+	extensions         []extension
+	filePatterns       []string
+	profiles           []*profile
+	metricNames        map[*prometheus.Desc]string
+	variableLabels     map[*prometheus.Desc][]string
+	devices            *deviceResolver
+	info               *prometheus.Desc
+	invocations        *invocationTracker
 	singleCollectors   map[string]collector
 	multipleCollectors map[string]multipleCollector
 }
 
+// Option configures optional behaviour of the collector returned by New.
+type Option func(*cgroupCollector)
+
+// labeler derives extra labels for a cgroup from its path. Every metric gets
+// the names of all configured labelers appended to its variable labels, so
+// values must return exactly one value per name. An empty value means the
+// label does not apply to that cgroup. newScrape, if not nil, is called
+// before the cgroups of a scrape are labeled, so caches can be pruned.
+type labeler struct {
+	names     []string
+	values    func(cgroup string) []string
+	newScrape func()
+}
+
+// metricLabels are the variable labels of the metrics of the collector, which
+// labelers can't set.
+var metricLabels = slices.Concat([]string{"cgroup", "cgroup_id", "path", "invocation_id", "device", "file"}, deviceLabels)
+
+// validateLabelers drops the labelers with invalid names or names set already,
+// by the collector or by the labelers before them, so the descriptors built
+// with their names are valid. It returns the names of the labels of every
+// metric.
+func (c *cgroupCollector) validateLabelers() []string {
+	labelNames := []string{"cgroup"}
+	var labelers []labeler
+	for _, l := range c.labelers {
+		if err := validateLabelNames(l.names, labelNames); err != nil {
+			slog.Error("invalid labels, not adding them", "labels", l.names, "error", err)
+			continue
+		}
+		labelNames = append(labelNames, l.names...)
+		labelers = append(labelers, l)
+	}
+	c.labelers = labelers
+	return labelNames
+}
+
+// validateLabelNames returns an error if names are invalid, repeated or
+// collide with the variable labels of the metrics or with set.
+func validateLabelNames(names, set []string) error {
+	for i, name := range names {
+		if !labelName.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if slices.Contains(metricLabels, name) || slices.Contains(set, name) || slices.Contains(names[:i], name) {
+			return fmt.Errorf("label %q is set already", name)
+		}
+	}
+	return nil
+}
+
+// setsLabel reports whether the metrics of every cgroup have the label name.
+func (c *cgroupCollector) setsLabel(name string) bool {
+	return name == "cgroup" || slices.ContainsFunc(c.labelers, func(l labeler) bool { return slices.Contains(l.names, name) })
+}
+
 type collector struct {
 	desc    *prometheus.Desc
 	collect collectFunc
@@ -35,339 +123,770 @@ type multipleCollector struct {
 	collect collectMultipleFunc
 }
 
-type collectFunc func(f io.Reader, path string, desc *prometheus.Desc, m chan<- prometheus.Metric) error
-type collectMultipleFunc func(f io.Reader, path string, desc map[string]desc, m chan<- prometheus.Metric) error
+// tableDescs returns the descriptors of the metrics of the files of a table.
+func tableDescs(singleCollectors map[string]collector, multipleCollectors map[string]multipleCollector) []*prometheus.Desc {
+	var descs []*prometheus.Desc
+	for _, col := range singleCollectors {
+		descs = append(descs, col.desc)
+	}
+	for _, col := range multipleCollectors {
+		for _, d := range col.descs {
+			descs = append(descs, d.desc)
+		}
+	}
+	return descs
+}
+
+// CollectFunc collects the metric desc from the file f of a cgroup. labels
+// are the label values of the cgroup, starting with the cgroup path itself,
+// and follow the values of the variable labels of the metric, if any.
+type CollectFunc func(f io.Reader, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error
+
+// collectFunc is a CollectFunc of the file read into b, which is only valid
+// during the call.
+type collectFunc func(b []byte, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error
+
+// collectMultipleFunc collects the metrics of the file b with multiple
+// metrics, keyed like descs.
+type collectMultipleFunc func(b []byte, labels []string, desc map[string]desc, m chan<- prometheus.Metric) error
 
 func microSecondsToSeconds(microseconds float64) float64 {
 	return microseconds / 1e6
 }
 
-func New(fs fs.FS, glob string) prometheus.Collector {
+func New(fs fs.FS, glob string, opts ...Option) prometheus.Collector {
+	c := &cgroupCollector{
+		fs:           fs,
+		stats:        newStats(),
+		errorHandler: logError,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
 	if glob == "" {
-		glob = "*"
-	}
-	return &cgroupCollector{
-		fs:   fs,
-		glob: glob,
-		singleCollectors: map[string]collector{
-			"memory.min":     {desc: prometheus.NewDesc("cgroup_memory_min_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.low":     {desc: prometheus.NewDesc("cgroup_memory_low_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.high":    {desc: prometheus.NewDesc("cgroup_memory_high_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.max":     {desc: prometheus.NewDesc("cgroup_memory_max_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.current": {desc: prometheus.NewDesc("cgroup_memory_current_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-
-			"memory.swap.high":    {desc: prometheus.NewDesc("cgroup_memory_swap_high_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.swap.max":     {desc: prometheus.NewDesc("cgroup_memory_swap_max_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.swap.current": {desc: prometheus.NewDesc("cgroup_memory_swap_current_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-
-			"memory.zswap.max":     {desc: prometheus.NewDesc("cgroup_memory_zswap_max_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"memory.zswap.current": {desc: prometheus.NewDesc("cgroup_memory_zswap_current_bytes", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-
-			"pids.current": {desc: prometheus.NewDesc("cgroup_pids_current", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-			"pids.max":     {desc: prometheus.NewDesc("cgroup_pids_max", "", []string{"cgroup"}, nil), collect: collectSingleValue(prometheus.GaugeValue)},
-		},
-		multipleCollectors: map[string]multipleCollector{
-			// TODO: memory.numastat
-			"memory.stat": {
-				descs: map[string]desc{
-					"anon":                     {desc: prometheus.NewDesc("cgroup_memory_anon_bytes", "Amount of memory used in anonymous mappings such as brk(), sbrk(), and mmap(MAP_ANONYMOUS)", []string{"cgroup"}, nil)},
-					"file":                     {desc: prometheus.NewDesc("cgroup_memory_file_bytes", "Amount of memory used to cache filesystem data, including tmpfs and shared memory.", []string{"cgroup"}, nil)},
-					"kernel":                   {desc: prometheus.NewDesc("cgroup_memory_kernel_bytes", "Amount of total kernel memory, including (kernel_stack, pagetables, percpu, vmalloc, slab) in addition to other kernel memory use cases.", []string{"cgroup"}, nil)},
-					"kernel_stack":             {desc: prometheus.NewDesc("cgroup_memory_kernel_stack_bytes", "Amount of memory allocated to kernel stacks.", []string{"cgroup"}, nil)},
-					"pagetables":               {desc: prometheus.NewDesc("cgroup_memory_pagetables_bytes", "Amount of memory allocated for page tables.", []string{"cgroup"}, nil)},
-					"sec_pagetables":           {desc: prometheus.NewDesc("cgroup_memory_sec_pagetables_bytes", "Amount of memory allocated for secondary page tables, this currently includes KVM mmu allocations on x86 and arm64 and IOMMU page tables.", []string{"cgroup"}, nil)},
-					"percpu":                   {desc: prometheus.NewDesc("cgroup_memory_percpu_bytes", "Amount of memory used for storing per-cpu kernel data structures.", []string{"cgroup"}, nil)},
-					"sock":                     {desc: prometheus.NewDesc("cgroup_memory_sock_bytes", "Amount of memory used in network transmission buffers", []string{"cgroup"}, nil)},
-					"vmalloc":                  {desc: prometheus.NewDesc("cgroup_memory_vmalloc_bytes", "Amount of memory used for vmap backed memory.", []string{"cgroup"}, nil)},
-					"shmem":                    {desc: prometheus.NewDesc("cgroup_memory_shmem_bytes", "Amount of cached filesystem data that is swap-backed, such as tmpfs, shm segments, shared anonymous mmap()s", []string{"cgroup"}, nil)},
-					"zswap":                    {desc: prometheus.NewDesc("cgroup_memory_zswap_bytes", "Amount of memory consumed by the zswap compression backend.", []string{"cgroup"}, nil)},
-					"zswapped":                 {desc: prometheus.NewDesc("cgroup_memory_zswapped_bytes", "Amount of application memory swapped out to zswap.", []string{"cgroup"}, nil)},
-					"file_mapped":              {desc: prometheus.NewDesc("cgroup_memory_file_mapped_bytes", "Amount of cached filesystem data mapped with mmap()", []string{"cgroup"}, nil)},
-					"file_dirty":               {desc: prometheus.NewDesc("cgroup_memory_file_dirty_bytes", "Amount of cached filesystem data that was modified but not yet written back to disk", []string{"cgroup"}, nil)},
-					"file_writeback":           {desc: prometheus.NewDesc("cgroup_memory_file_writeback_bytes", "Amount of cached filesystem data that was modified and is currently being written back to disk", []string{"cgroup"}, nil)},
-					"swapcached":               {desc: prometheus.NewDesc("cgroup_memory_swapcached_bytes", "Amount of swap cached in memory. The swapcache is accounted against both memory and swap usage.", []string{"cgroup"}, nil)},
-					"anon_thp":                 {desc: prometheus.NewDesc("cgroup_memory_anon_thp_bytes", "Amount of memory used in anonymous mappings backed by transparent hugepages", []string{"cgroup"}, nil)},
-					"file_thp":                 {desc: prometheus.NewDesc("cgroup_memory_file_thp_bytes", "Amount of cached filesystem data backed by transparent hugepages", []string{"cgroup"}, nil)},
-					"shmem_thp":                {desc: prometheus.NewDesc("cgroup_memory_shmem_thp_bytes", "Amount of shm, tmpfs, shared anonymous mmap()s backed by transparent hugepages", []string{"cgroup"}, nil)},
-					"inactive_anon":            {desc: prometheus.NewDesc("cgroup_memory_inactive_anon_bytes", "Amount of memory on the inactive anonymous list", []string{"cgroup"}, nil)},
-					"active_anon":              {desc: prometheus.NewDesc("cgroup_memory_active_anon_bytes", "Amount of memory on the active anonymous list", []string{"cgroup"}, nil)},
-					"inactive_file":            {desc: prometheus.NewDesc("cgroup_memory_inactive_file_bytes", "Amount of memory on the inactive file list", []string{"cgroup"}, nil)},
-					"active_file":              {desc: prometheus.NewDesc("cgroup_memory_active_file_bytes", "Amount of memory on the active file list", []string{"cgroup"}, nil)},
-					"unevictable":              {desc: prometheus.NewDesc("cgroup_memory_unevictable_bytes", "Amount of memory that cannot be reclaimed", []string{"cgroup"}, nil)},
-					"slab_reclaimable":         {desc: prometheus.NewDesc("cgroup_memory_slab_reclaimable_bytes", "Amount of slab memory that might be reclaimed, such as dentries and inodes.", []string{"cgroup"}, nil)},
-					"slab_unreclaimable":       {desc: prometheus.NewDesc("cgroup_memory_slab_unreclaimable_bytes", "Amount of slab memory that cannot be reclaimed under memory pressure.", []string{"cgroup"}, nil)},
-					"slab":                     {desc: prometheus.NewDesc("cgroup_memory_slab_bytes", "Amount of memory used for storing in-kernel data structures.", []string{"cgroup"}, nil)},
-					"workingset_refault_anon":  {desc: prometheus.NewDesc("cgroup_memory_workingset_refault_anon", "Number of refaults of previously evicted anonymous pages.", []string{"cgroup"}, nil)},
-					"workingset_refault_file":  {desc: prometheus.NewDesc("cgroup_memory_workingset_refault_file", "Number of refaults of previously evicted file pages.", []string{"cgroup"}, nil)},
-					"workingset_activate_anon": {desc: prometheus.NewDesc("cgroup_memory_workingset_activate_anon", "Number of refaulted anonymous pages that were immediately activated.", []string{"cgroup"}, nil)},
-					"workingset_activate_file": {desc: prometheus.NewDesc("cgroup_memory_workingset_activate_file", "Number of refaulted file pages that were immediately activated.", []string{"cgroup"}, nil)},
-					"workingset_restore_anon":  {desc: prometheus.NewDesc("cgroup_memory_workingset_restore_anon", "Number of restored anonymous pages detected as an active workingset before they got reclaimed.", []string{"cgroup"}, nil)},
-					"workingset_restore_file":  {desc: prometheus.NewDesc("cgroup_memory_workingset_restore_file", "Number of restored file pages detected as an active workingset before they got reclaimed.", []string{"cgroup"}, nil)},
-					"workingset_nodereclaim":   {desc: prometheus.NewDesc("cgroup_memory_workingset_nodereclaim", "Number of times a shadow node has been reclaimed.", []string{"cgroup"}, nil)},
-					"pgscan":                   {desc: prometheus.NewDesc("cgroup_memory_pgscan", "Amount of scanned pages (in an inactive LRU list)", []string{"cgroup"}, nil)},
-					"pgsteal":                  {desc: prometheus.NewDesc("cgroup_memory_pgsteal", "Amount of reclaimed pages.", []string{"cgroup"}, nil)},
-					"pgscan_kswapd":            {desc: prometheus.NewDesc("cgroup_memory_pgscan_kswapd", "Amount of scanned pages by kswapd (in an inactive LRU list)", []string{"cgroup"}, nil)},
-					"pgscan_direct":            {desc: prometheus.NewDesc("cgroup_memory_pgscan_direct", "Amount of scanned pages directly (in an inactive LRU list)", []string{"cgroup"}, nil)},
-					"pgscan_khugepaged":        {desc: prometheus.NewDesc("cgroup_memory_pgscan_khugepaged", "Amount of scanned pages by khugepaged (in an inactive LRU list)", []string{"cgroup"}, nil)},
-					"pgsteal_kswapd":           {desc: prometheus.NewDesc("cgroup_memory_pgsteal_kswapd", "Amount of reclaimed pages by kswapd", []string{"cgroup"}, nil)},
-					"pgsteal_direct":           {desc: prometheus.NewDesc("cgroup_memory_pgsteal_direct", "Amount of reclaimed pages directly", []string{"cgroup"}, nil)},
-					"pgsteal_khugepaged":       {desc: prometheus.NewDesc("cgroup_memory_pgsteal_khugepaged", "Amount of reclaimed pages by khugepaged", []string{"cgroup"}, nil)},
-					"pgfault":                  {desc: prometheus.NewDesc("cgroup_memory_pgfault", "Total number of page faults incurred.", []string{"cgroup"}, nil)},
-					"pgmajfault":               {desc: prometheus.NewDesc("cgroup_memory_pgmajfault", "Number of major page faults incurred.", []string{"cgroup"}, nil)},
-					"pgrefill":                 {desc: prometheus.NewDesc("cgroup_memory_pgrefill", "Amount of scanned pages (in an active LRU list).", []string{"cgroup"}, nil)},
-					"pgactivate":               {desc: prometheus.NewDesc("cgroup_memory_pgactivate", "Amount of pages moved to the active LRU list.", []string{"cgroup"}, nil)},
-					"pgdeactivate":             {desc: prometheus.NewDesc("cgroup_memory_pgdeactivate", "Amount of pages moved to the inactive LRU list.", []string{"cgroup"}, nil)},
-					"pglazyfree":               {desc: prometheus.NewDesc("cgroup_memory_pglazyfree", "Amount of pages postponed to be freed under memory pressure.", []string{"cgroup"}, nil)},
-					"pglazyfreed":              {desc: prometheus.NewDesc("cgroup_memory_pglazyfreed", "Amount of reclaimed lazyfree pages.", []string{"cgroup"}, nil)},
-					"zswpin":                   {desc: prometheus.NewDesc("cgroup_memory_zswpin", "Number of pages moved in to memory from zswap.", []string{"cgroup"}, nil)},
-					"zswpout":                  {desc: prometheus.NewDesc("cgroup_memory_zswpout", "Number of pages moved out of memory to zswap.", []string{"cgroup"}, nil)},
-					"zswpwb":                   {desc: prometheus.NewDesc("cgroup_memory_zswpwb", "Number of pages written from zswap to swap.", []string{"cgroup"}, nil)},
-					"thp_fault_alloc":          {desc: prometheus.NewDesc("cgroup_memory_thp_fault_alloc", "Number of transparent hugepages allocated to satisfy a page fault.", []string{"cgroup"}, nil)},
-					"thp_collapse_alloc":       {desc: prometheus.NewDesc("cgroup_memory_thp_collapse_alloc", "Number of transparent hugepages allocated to allow collapsing an existing range of pages.", []string{"cgroup"}, nil)},
-					"thp_swpout":               {desc: prometheus.NewDesc("cgroup_memory_thp_swpout", "Number of transparent hugepages which are swapout in one piece without splitting.", []string{"cgroup"}, nil)},
-					"thp_swpout_fallback":      {desc: prometheus.NewDesc("cgroup_memory_thp_swpout_fallback", "Number of transparent hugepages split before swapout due to failed allocation of continuous swap space.", []string{"cgroup"}, nil)},
-				},
-				collect: collectFlatKeyed(prometheus.GaugeValue),
+		glob = c.glob
+	}
+	if glob != "" {
+		if err := ValidatePattern(glob); err != nil {
+			slog.Error("invalid cgroup pattern, it matches nothing", "pattern", glob, "error", err)
+		}
+		c.includes = append([]pattern{strings.Split(glob, "/")}, c.includes...)
+	}
+	if len(c.includes) == 0 {
+		c.includes = []pattern{{"*"}}
+	}
+	labelNames := c.validateLabelers()
+	c.metricNames = make(map[*prometheus.Desc]string)
+	c.variableLabels = make(map[*prometheus.Desc][]string)
+	newDesc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		d := prometheus.NewDesc(name, help, slices.Concat(variableLabels, labelNames), nil)
+		c.metricNames[d] = name
+		c.variableLabels[d] = variableLabels
+		return d
+	}
+	deviceLabelNames := []string{"device"}
+	if c.devices != nil {
+		deviceLabelNames = append(deviceLabelNames, deviceLabels...)
+	}
+	c.info = newDesc("cgroup_info", "Information about the cgroup. cgroup_id is the kernel's cgroup ID, the inode number of its directory, and path its absolute path as found in /proc/<pid>/cgroup.", "cgroup_id", "path")
+	if c.invocations != nil {
+		c.invocations.info = newDesc("cgroup_invocation_info", "The systemd invocation ID of the unit owning the cgroup. It changes every time the unit is started.", "invocation_id")
+		c.invocations.changes = newDesc("cgroup_invocation_changes_total", "Number of times the invocation ID of the cgroup was seen to change, i.e. the unit was restarted.")
+	}
+	c.singleCollectors = map[string]collector{
+		"memory.min":     {desc: newDesc("cgroup_memory_min_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.low":     {desc: newDesc("cgroup_memory_low_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.high":    {desc: newDesc("cgroup_memory_high_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.max":     {desc: newDesc("cgroup_memory_max_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.current": {desc: newDesc("cgroup_memory_current_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+
+		"memory.swap.high":    {desc: newDesc("cgroup_memory_swap_high_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.swap.max":     {desc: newDesc("cgroup_memory_swap_max_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.swap.current": {desc: newDesc("cgroup_memory_swap_current_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+
+		"memory.zswap.max":     {desc: newDesc("cgroup_memory_zswap_max_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"memory.zswap.current": {desc: newDesc("cgroup_memory_zswap_current_bytes", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+
+		"pids.current": {desc: newDesc("cgroup_pids_current", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+		"pids.max":     {desc: newDesc("cgroup_pids_max", ""), collect: collectSingle(prometheus.GaugeValue, parseValue)},
+	}
+	c.multipleCollectors = map[string]multipleCollector{
+		// TODO: memory.numastat
+		"memory.stat": {
+			descs: map[string]desc{
+				"anon":                     {desc: newDesc("cgroup_memory_anon_bytes", "Amount of memory used in anonymous mappings such as brk(), sbrk(), and mmap(MAP_ANONYMOUS)")},
+				"file":                     {desc: newDesc("cgroup_memory_file_bytes", "Amount of memory used to cache filesystem data, including tmpfs and shared memory.")},
+				"kernel":                   {desc: newDesc("cgroup_memory_kernel_bytes", "Amount of total kernel memory, including (kernel_stack, pagetables, percpu, vmalloc, slab) in addition to other kernel memory use cases.")},
+				"kernel_stack":             {desc: newDesc("cgroup_memory_kernel_stack_bytes", "Amount of memory allocated to kernel stacks.")},
+				"pagetables":               {desc: newDesc("cgroup_memory_pagetables_bytes", "Amount of memory allocated for page tables.")},
+				"sec_pagetables":           {desc: newDesc("cgroup_memory_sec_pagetables_bytes", "Amount of memory allocated for secondary page tables, this currently includes KVM mmu allocations on x86 and arm64 and IOMMU page tables.")},
+				"percpu":                   {desc: newDesc("cgroup_memory_percpu_bytes", "Amount of memory used for storing per-cpu kernel data structures.")},
+				"sock":                     {desc: newDesc("cgroup_memory_sock_bytes", "Amount of memory used in network transmission buffers")},
+				"vmalloc":                  {desc: newDesc("cgroup_memory_vmalloc_bytes", "Amount of memory used for vmap backed memory.")},
+				"shmem":                    {desc: newDesc("cgroup_memory_shmem_bytes", "Amount of cached filesystem data that is swap-backed, such as tmpfs, shm segments, shared anonymous mmap()s")},
+				"zswap":                    {desc: newDesc("cgroup_memory_zswap_bytes", "Amount of memory consumed by the zswap compression backend.")},
+				"zswapped":                 {desc: newDesc("cgroup_memory_zswapped_bytes", "Amount of application memory swapped out to zswap.")},
+				"file_mapped":              {desc: newDesc("cgroup_memory_file_mapped_bytes", "Amount of cached filesystem data mapped with mmap()")},
+				"file_dirty":               {desc: newDesc("cgroup_memory_file_dirty_bytes", "Amount of cached filesystem data that was modified but not yet written back to disk")},
+				"file_writeback":           {desc: newDesc("cgroup_memory_file_writeback_bytes", "Amount of cached filesystem data that was modified and is currently being written back to disk")},
+				"swapcached":               {desc: newDesc("cgroup_memory_swapcached_bytes", "Amount of swap cached in memory. The swapcache is accounted against both memory and swap usage.")},
+				"anon_thp":                 {desc: newDesc("cgroup_memory_anon_thp_bytes", "Amount of memory used in anonymous mappings backed by transparent hugepages")},
+				"file_thp":                 {desc: newDesc("cgroup_memory_file_thp_bytes", "Amount of cached filesystem data backed by transparent hugepages")},
+				"shmem_thp":                {desc: newDesc("cgroup_memory_shmem_thp_bytes", "Amount of shm, tmpfs, shared anonymous mmap()s backed by transparent hugepages")},
+				"inactive_anon":            {desc: newDesc("cgroup_memory_inactive_anon_bytes", "Amount of memory on the inactive anonymous list")},
+				"active_anon":              {desc: newDesc("cgroup_memory_active_anon_bytes", "Amount of memory on the active anonymous list")},
+				"inactive_file":            {desc: newDesc("cgroup_memory_inactive_file_bytes", "Amount of memory on the inactive file list")},
+				"active_file":              {desc: newDesc("cgroup_memory_active_file_bytes", "Amount of memory on the active file list")},
+				"unevictable":              {desc: newDesc("cgroup_memory_unevictable_bytes", "Amount of memory that cannot be reclaimed")},
+				"slab_reclaimable":         {desc: newDesc("cgroup_memory_slab_reclaimable_bytes", "Amount of slab memory that might be reclaimed, such as dentries and inodes.")},
+				"slab_unreclaimable":       {desc: newDesc("cgroup_memory_slab_unreclaimable_bytes", "Amount of slab memory that cannot be reclaimed under memory pressure.")},
+				"slab":                     {desc: newDesc("cgroup_memory_slab_bytes", "Amount of memory used for storing in-kernel data structures.")},
+				"workingset_refault_anon":  {desc: newDesc("cgroup_memory_workingset_refault_anon", "Number of refaults of previously evicted anonymous pages.")},
+				"workingset_refault_file":  {desc: newDesc("cgroup_memory_workingset_refault_file", "Number of refaults of previously evicted file pages.")},
+				"workingset_activate_anon": {desc: newDesc("cgroup_memory_workingset_activate_anon", "Number of refaulted anonymous pages that were immediately activated.")},
+				"workingset_activate_file": {desc: newDesc("cgroup_memory_workingset_activate_file", "Number of refaulted file pages that were immediately activated.")},
+				"workingset_restore_anon":  {desc: newDesc("cgroup_memory_workingset_restore_anon", "Number of restored anonymous pages detected as an active workingset before they got reclaimed.")},
+				"workingset_restore_file":  {desc: newDesc("cgroup_memory_workingset_restore_file", "Number of restored file pages detected as an active workingset before they got reclaimed.")},
+				"workingset_nodereclaim":   {desc: newDesc("cgroup_memory_workingset_nodereclaim", "Number of times a shadow node has been reclaimed.")},
+				"pgscan":                   {desc: newDesc("cgroup_memory_pgscan", "Amount of scanned pages (in an inactive LRU list)")},
+				"pgsteal":                  {desc: newDesc("cgroup_memory_pgsteal", "Amount of reclaimed pages.")},
+				"pgscan_kswapd":            {desc: newDesc("cgroup_memory_pgscan_kswapd", "Amount of scanned pages by kswapd (in an inactive LRU list)")},
+				"pgscan_direct":            {desc: newDesc("cgroup_memory_pgscan_direct", "Amount of scanned pages directly (in an inactive LRU list)")},
+				"pgscan_khugepaged":        {desc: newDesc("cgroup_memory_pgscan_khugepaged", "Amount of scanned pages by khugepaged (in an inactive LRU list)")},
+				"pgsteal_kswapd":           {desc: newDesc("cgroup_memory_pgsteal_kswapd", "Amount of reclaimed pages by kswapd")},
+				"pgsteal_direct":           {desc: newDesc("cgroup_memory_pgsteal_direct", "Amount of reclaimed pages directly")},
+				"pgsteal_khugepaged":       {desc: newDesc("cgroup_memory_pgsteal_khugepaged", "Amount of reclaimed pages by khugepaged")},
+				"pgfault":                  {desc: newDesc("cgroup_memory_pgfault", "Total number of page faults incurred.")},
+				"pgmajfault":               {desc: newDesc("cgroup_memory_pgmajfault", "Number of major page faults incurred.")},
+				"pgrefill":                 {desc: newDesc("cgroup_memory_pgrefill", "Amount of scanned pages (in an active LRU list).")},
+				"pgactivate":               {desc: newDesc("cgroup_memory_pgactivate", "Amount of pages moved to the active LRU list.")},
+				"pgdeactivate":             {desc: newDesc("cgroup_memory_pgdeactivate", "Amount of pages moved to the inactive LRU list.")},
+				"pglazyfree":               {desc: newDesc("cgroup_memory_pglazyfree", "Amount of pages postponed to be freed under memory pressure.")},
+				"pglazyfreed":              {desc: newDesc("cgroup_memory_pglazyfreed", "Amount of reclaimed lazyfree pages.")},
+				"zswpin":                   {desc: newDesc("cgroup_memory_zswpin", "Number of pages moved in to memory from zswap.")},
+				"zswpout":                  {desc: newDesc("cgroup_memory_zswpout", "Number of pages moved out of memory to zswap.")},
+				"zswpwb":                   {desc: newDesc("cgroup_memory_zswpwb", "Number of pages written from zswap to swap.")},
+				"thp_fault_alloc":          {desc: newDesc("cgroup_memory_thp_fault_alloc", "Number of transparent hugepages allocated to satisfy a page fault.")},
+				"thp_collapse_alloc":       {desc: newDesc("cgroup_memory_thp_collapse_alloc", "Number of transparent hugepages allocated to allow collapsing an existing range of pages.")},
+				"thp_swpout":               {desc: newDesc("cgroup_memory_thp_swpout", "Number of transparent hugepages which are swapout in one piece without splitting.")},
+				"thp_swpout_fallback":      {desc: newDesc("cgroup_memory_thp_swpout_fallback", "Number of transparent hugepages split before swapout due to failed allocation of continuous swap space.")},
 			},
-			"memory.events": {descs: map[string]desc{
-				"low":            {desc: prometheus.NewDesc("cgroup_memory_events_low_total", "", []string{"cgroup"}, nil)},
-				"high":           {desc: prometheus.NewDesc("cgroup_memory_events_high_total", "", []string{"cgroup"}, nil)},
-				"max":            {desc: prometheus.NewDesc("cgroup_memory_events_max_total", "", []string{"cgroup"}, nil)},
-				"oom":            {desc: prometheus.NewDesc("cgroup_memory_events_oom_total", "", []string{"cgroup"}, nil)},
-				"oom_kill":       {desc: prometheus.NewDesc("cgroup_memory_events_oom_kill_total", "", []string{"cgroup"}, nil)},
-				"oom_group_kill": {desc: prometheus.NewDesc("cgroup_memory_events_oom_group_kill_total", "", []string{"cgroup"}, nil)},
-			}, collect: collectFlatKeyed(prometheus.CounterValue)},
-			"memory.pressure": {descs: map[string]desc{
-				"some": {desc: prometheus.NewDesc("cgroup_memory_pressure_waiting_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"full": {desc: prometheus.NewDesc("cgroup_memory_pressure_stalled_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-			}, collect: collectPressure},
-			"cpu.pressure": {descs: map[string]desc{
-				"some": {desc: prometheus.NewDesc("cgroup_cpu_pressure_waiting_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"full": {desc: prometheus.NewDesc("cgroup_cpu_pressure_stalled_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-			}, collect: collectPressure},
-			"io.pressure": {descs: map[string]desc{
-				"some": {desc: prometheus.NewDesc("cgroup_io_pressure_waiting_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"full": {desc: prometheus.NewDesc("cgroup_io_pressure_stalled_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-			}, collect: collectPressure},
-			"cpu.stat": {descs: map[string]desc{
-				"usage_usec":                 {desc: prometheus.NewDesc("cgroup_cpu_usage_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"user_usec":                  {desc: prometheus.NewDesc("cgroup_cpu_user_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"system_usec":                {desc: prometheus.NewDesc("cgroup_cpu_system_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"nr_periods":                 {desc: prometheus.NewDesc("cgroup_cpu_periods_total", "", []string{"cgroup"}, nil)},
-				"nr_throttled":               {desc: prometheus.NewDesc("cgroup_cpu_throttled_total", "", []string{"cgroup"}, nil)},
-				"throttled_usec":             {desc: prometheus.NewDesc("cgroup_cpu_throttled_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"nr_bursts":                  {desc: prometheus.NewDesc("cgroup_cpu_bursts_total", "", []string{"cgroup"}, nil)},
-				"burst_usec":                 {desc: prometheus.NewDesc("cgroup_cpu_burst_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-				"core_sched.force_idle_usec": {desc: prometheus.NewDesc("cgroup_cpu_core_sched_force_idle_seconds_total", "", []string{"cgroup"}, nil), modifier: microSecondsToSeconds},
-			}, collect: collectFlatKeyed(prometheus.CounterValue)},
-			"io.stat": {descs: map[string]desc{
-				"rbytes": {desc: prometheus.NewDesc("cgroup_io_read_bytes_total", "", []string{"device", "cgroup"}, nil)},
-				"wbytes": {desc: prometheus.NewDesc("cgroup_io_write_bytes_total", "", []string{"device", "cgroup"}, nil)},
-				"dbytes": {desc: prometheus.NewDesc("cgroup_io_discard_bytes_total", "", []string{"device", "cgroup"}, nil)},
-				"rios":   {desc: prometheus.NewDesc("cgroup_io_read_operations_total", "", []string{"device", "cgroup"}, nil)},
-				"wios":   {desc: prometheus.NewDesc("cgroup_io_write_operations_total", "", []string{"device", "cgroup"}, nil)},
-				"dios":   {desc: prometheus.NewDesc("cgroup_io_discard_operations_total", "", []string{"device", "cgroup"}, nil)},
-			}, collect: collectIOStat},
-			"pids.events": {descs: map[string]desc{
-				"max": {desc: prometheus.NewDesc("cgroup_pids_events_max_total", "", []string{"cgroup"}, nil)},
-			}, collect: collectFlatKeyed(prometheus.CounterValue)},
+			collect: collectStat(cgroupfs.ParseMemoryStat, prometheus.GaugeValue),
 		},
+		"memory.events": {descs: map[string]desc{
+			"low":            {desc: newDesc("cgroup_memory_events_low_total", "")},
+			"high":           {desc: newDesc("cgroup_memory_events_high_total", "")},
+			"max":            {desc: newDesc("cgroup_memory_events_max_total", "")},
+			"oom":            {desc: newDesc("cgroup_memory_events_oom_total", "")},
+			"oom_kill":       {desc: newDesc("cgroup_memory_events_oom_kill_total", "")},
+			"oom_group_kill": {desc: newDesc("cgroup_memory_events_oom_group_kill_total", "")},
+		}, collect: collectStat(cgroupfs.ParseMemoryEvents, prometheus.CounterValue)},
+		"memory.pressure": {descs: map[string]desc{
+			"some": {desc: newDesc("cgroup_memory_pressure_waiting_seconds_total", ""), modifier: microSecondsToSeconds},
+			"full": {desc: newDesc("cgroup_memory_pressure_stalled_seconds_total", ""), modifier: microSecondsToSeconds},
+		}, collect: collectPressure},
+		"cpu.pressure": {descs: map[string]desc{
+			"some": {desc: newDesc("cgroup_cpu_pressure_waiting_seconds_total", ""), modifier: microSecondsToSeconds},
+			"full": {desc: newDesc("cgroup_cpu_pressure_stalled_seconds_total", ""), modifier: microSecondsToSeconds},
+		}, collect: collectPressure},
+		"io.pressure": {descs: map[string]desc{
+			"some": {desc: newDesc("cgroup_io_pressure_waiting_seconds_total", ""), modifier: microSecondsToSeconds},
+			"full": {desc: newDesc("cgroup_io_pressure_stalled_seconds_total", ""), modifier: microSecondsToSeconds},
+		}, collect: collectPressure},
+		"cpu.stat": {descs: map[string]desc{
+			"usage_usec":                 {desc: newDesc("cgroup_cpu_usage_seconds_total", ""), modifier: microSecondsToSeconds},
+			"user_usec":                  {desc: newDesc("cgroup_cpu_user_seconds_total", ""), modifier: microSecondsToSeconds},
+			"system_usec":                {desc: newDesc("cgroup_cpu_system_seconds_total", ""), modifier: microSecondsToSeconds},
+			"nr_periods":                 {desc: newDesc("cgroup_cpu_periods_total", "")},
+			"nr_throttled":               {desc: newDesc("cgroup_cpu_throttled_total", "")},
+			"throttled_usec":             {desc: newDesc("cgroup_cpu_throttled_seconds_total", ""), modifier: microSecondsToSeconds},
+			"nr_bursts":                  {desc: newDesc("cgroup_cpu_bursts_total", "")},
+			"burst_usec":                 {desc: newDesc("cgroup_cpu_burst_seconds_total", ""), modifier: microSecondsToSeconds},
+			"core_sched.force_idle_usec": {desc: newDesc("cgroup_cpu_core_sched_force_idle_seconds_total", ""), modifier: microSecondsToSeconds},
+		}, collect: collectStat(cgroupfs.ParseCPUStat, prometheus.CounterValue)},
+		"io.stat": {descs: map[string]desc{
+			"rbytes": {desc: newDesc("cgroup_io_read_bytes_total", "", deviceLabelNames...)},
+			"wbytes": {desc: newDesc("cgroup_io_write_bytes_total", "", deviceLabelNames...)},
+			"dbytes": {desc: newDesc("cgroup_io_discard_bytes_total", "", deviceLabelNames...)},
+			"rios":   {desc: newDesc("cgroup_io_read_operations_total", "", deviceLabelNames...)},
+			"wios":   {desc: newDesc("cgroup_io_write_operations_total", "", deviceLabelNames...)},
+			"dios":   {desc: newDesc("cgroup_io_discard_operations_total", "", deviceLabelNames...)},
+		}, collect: collectIOStat(c.devices)},
+		"pids.events": {descs: map[string]desc{
+			"max": {desc: newDesc("cgroup_pids_events_max_total", "")},
+		}, collect: collectStat(cgroupfs.ParsePidsEvents, prometheus.CounterValue)},
 	}
+	for _, p := range c.profileConfigs {
+		profile, err := c.newProfile(p)
+		if err != nil {
+			slog.Error("invalid profile", "match", p.Match, "error", err)
+			continue
+		}
+		c.profiles = append(c.profiles, profile)
+	}
+	if c.files != nil {
+		for name := range c.singleCollectors {
+			if !c.files[name] {
+				delete(c.singleCollectors, name)
+			}
+		}
+		for name := range c.multipleCollectors {
+			if !c.files[name] {
+				delete(c.multipleCollectors, name)
+			}
+		}
+	}
+	for _, fc := range c.fileCollectors {
+		if err := c.addFileCollector(fc, newDesc); err != nil {
+			slog.Error("invalid file collector", "file", fc.File, "error", err)
+		}
+	}
+	for _, e := range c.extensions {
+		if err := c.addExtension(e, newDesc); err != nil {
+			slog.Error("invalid file collector", "file", e.file, "error", err)
+		}
+	}
+	if c.background != nil {
+		c.background.start(c)
+	}
+	return c
+}
+
+// labels returns the label values for the cgroup at path.
+func (c *cgroupCollector) labels(path string) []string {
+	labels := []string{path}
+	for _, l := range c.labelers {
+		labels = append(labels, l.values(path)...)
+	}
+	if c.rewrite != nil {
+		labels[0] = c.rewrite(path)
+	}
+	return labels
 }
 
 // Collect implements prometheus.Collector.
 func (c *cgroupCollector) Collect(m chan<- prometheus.Metric) {
-	matches, err := fs.Glob(c.fs, c.glob)
-	if err != nil {
-		slog.Error("failed to glob cgroups", "error", err)
+	if c.background != nil {
+		c.collectSnapshot(m)
+		return
 	}
-	for _, match := range matches {
-		if err := fs.WalkDir(c.fs, match, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return fmt.Errorf("failed to walk cgroup: %w", err)
-			}
-			if d.IsDir() {
-				return nil
-			}
+	start := time.Now()
+	s := c.scan(nil)
+	if c.limits != nil {
+		c.limits.collect(s.order, c.workers, c.gatherCgroups, m)
+	} else {
+		c.collectCgroups(s.order, m)
+	}
+	c.forget(s)
+	if c.selfMetrics {
+		c.stats.collect(time.Since(start), len(s.cgroups), c.deadline.wasTruncated(), m)
+	}
+}
 
-			name := d.Name()
+// scan discovers the cgroups to collect. If due is not nil, only the cgroups
+// whose background schedule is due are, see background.
+func (c *cgroupCollector) scan(due []bool) *scrape {
+	s := &scrape{
+		due:      due,
+		included: make(map[string][]bool),
+		idle:     make(map[string]bool),
+		cgroups:  make(map[string]*cgroupEntry),
+		rollups:  make(map[string]bool),
+	}
+	if c.devices != nil {
+		c.devices.newScrape()
+	}
+	for _, l := range c.labelers {
+		if l.newScrape != nil {
+			l.newScrape()
+		}
+	}
+	if err := fs.WalkDir(c.fs, ".", func(path string, d fs.DirEntry, err error) error {
+		return c.discover(s, path, d, err)
+	}); err != nil {
+		c.report("", reasonWalk, err)
+	}
+	if c.rollups != nil {
+		c.rollUp(s)
+	}
+	return s
+}
 
-			if col, ok := c.singleCollectors[name]; ok {
-				f, err := c.fs.Open(path)
-				if err != nil {
-					return fmt.Errorf("failed to open file %q: %w", path, err)
-				}
-				defer f.Close()
-				if err := col.collect(f, filepath.Dir(path), col.desc, m); err != nil {
-					slog.Error("failed to collect cgroup", "error", err)
-				}
-			}
-			if col, ok := c.multipleCollectors[name]; ok {
-				f, err := c.fs.Open(path)
-				if err != nil {
-					return fmt.Errorf("failed to open file %q: %w", path, err)
-				}
-				defer f.Close()
-				if err := col.collect(f, filepath.Dir(path), col.descs, m); err != nil {
-					slog.Error("failed to collect cgroup", "error", err)
-				}
-			}
+// forget drops the state kept for the cgroups that were not found by the
+// scrape s, unless c is filtered or s was truncated and didn't look for all
+// cgroups.
+func (c *cgroupCollector) forget(s *scrape) {
+	if c.filtered || c.deadline.wasTruncated() {
+		return
+	}
+	if c.invocations != nil {
+		c.invocations.forget(s.cgroups)
+	}
+	if c.rollups != nil {
+		c.rollups.forget(s.rollups)
+	}
+}
 
-			// TODO: refactor stuff so this is generic
-			if name == "io.stat" {
+// discover is the fs.WalkDirFunc that finds the cgroups and files to collect.
+func (c *cgroupCollector) discover(s *scrape, path string, d fs.DirEntry, err error) error {
+	if c.deadline.expired() {
+		return fs.SkipAll
+	}
+	if err != nil {
+		if path == "." || !vanished(err) {
+			// skip the cgroup that can't be walked, not the whole hierarchy
+			c.report("", reasonWalk, fmt.Errorf("failed to walk cgroup %q: %w", path, err))
+			if path == "." {
+				return nil
 			}
-
-			return nil
-		}); err != nil {
-			slog.Error("failed to walk cgroup", "error", err)
+			return fs.SkipDir
 		}
+		// the cgroup was removed while walking it, carry on with its siblings
+		if cgroup, ok := s.cgroups[path]; ok {
+			c.vanish(cgroup)
+		} else {
+			c.stats.cgroupVanished()
+		}
+		return nil
 	}
-}
+	if path == "." {
+		if s.due != nil && !c.due(s.due, path) {
+			s.idle[path] = true
+		}
+		return nil
+	}
+	if matchAny(c.excludes, path) {
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+		return nil
+	}
+	included, all := c.included(s.included[filepath.Dir(path)], path)
 
-func collectIOStat(f io.Reader, path string, descs map[string]desc, m chan<- prometheus.Metric) error {
-	return visitNestedKeyed(f, func(n string) (kvVisitor, error) {
-		device := n
-		return func(k, v string) error {
-			desc, ok := descs[k]
-			if !ok {
-				return nil
+	if d.IsDir() {
+		if c.maxDepth > 0 && depth(path) > c.maxDepth {
+			return fs.SkipDir
+		}
+		s.included[path] = included
+		if s.due != nil && !c.due(s.due, path) {
+			if !c.dueBelow(s.due, path) {
+				return fs.SkipDir
+			}
+			// walk on to the cgroups below with a schedule that is due
+			s.idle[path] = true
+			all = false
+		}
+		if all {
+			info, err := d.Info()
+			if vanished(err) {
+				c.stats.cgroupVanished()
+				return fs.SkipDir
 			}
-			value, err := strconv.ParseFloat(v, 64)
 			if err != nil {
-				return fmt.Errorf("failed to parse value %q: %w", v, err)
+				c.report("", reasonWalk, fmt.Errorf("failed to stat cgroup %q: %w", path, err))
+				return fs.SkipDir
 			}
-			m <- prometheus.MustNewConstMetric(desc.desc, prometheus.CounterValue, value, device, path)
+			if c.skipUnpopulated && !c.populated(path) {
+				if c.unpopulatedInfo {
+					s.add(c.newCgroupEntry(path, info))
+				}
+				return fs.SkipDir
+			}
+			s.add(c.newCgroupEntry(path, info))
 			return nil
-		}, nil
-	})
+		}
+		for i, layer := range c.includeLayers() {
+			if !included[i] && !matchAnyBelow(layer, path) {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	}
+
+	if !all || s.idle[filepath.Dir(path)] {
+		return nil
+	}
+
+	name := d.Name()
+	key := c.fileKey(name)
+	if c.collect != nil && !c.collect[key] {
+		return nil
+	}
+	cgroup := c.cgroupEntry(s, path)
+	_, single := cgroup.singleCollectors[key]
+	_, multiple := cgroup.multipleCollectors[key]
+	if single || multiple {
+		cgroup.files = append(cgroup.files, name)
+	}
+	return nil
 }
 
-func collectSingleValue(valueType prometheus.ValueType) collectFunc {
-	return func(f io.Reader, path string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+// collectCgroup collects the metrics of a discovered cgroup.
+func (c *cgroupCollector) collectCgroup(cgroup *cgroupEntry, m chan<- prometheus.Metric) {
+	if cgroup.members != nil {
+		c.collectRollup(cgroup, m)
+		return
+	}
+	if cgroup.vanished.Load() || c.deadline.expired() {
+		return
+	}
+	if c.invocations != nil {
+		c.invocations.collect(cgroup.path, cgroup.labels, m)
+	}
+	if cgroup.info != nil {
+		if ino, ok := inode(cgroup.info); ok {
+			m <- prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, append([]string{strconv.FormatUint(ino, 10), absolutePath(cgroup.path)}, cgroup.labels...)...)
+		}
+	}
+	c.collectFiles(cgroup, m)
+}
 
-		var val string
-		if _, err := fmt.Fscanf(f, "%s", &val); err != nil {
-			return fmt.Errorf("failed to read value: %w", err)
+// collectFiles collects the files of cgroup, which are read relative to its
+// directory, opened once.
+func (c *cgroupCollector) collectFiles(cgroup *cgroupEntry, m chan<- prometheus.Metric) {
+	if len(cgroup.files) == 0 || cgroup.vanished.Load() {
+		return
+	}
+	dir, err := cgroupfs.OpenDir(c.fs, cgroup.path)
+	if vanished(err) {
+		c.vanish(cgroup)
+		return
+	}
+	if err != nil {
+		c.report("", reasonOpen, fmt.Errorf("failed to open cgroup %q: %w", cgroup.path, err))
+		return
+	}
+	defer dir.Close()
+	buf := cgroupfs.GetBuffer()
+	defer cgroupfs.PutBuffer(buf)
+	for _, name := range cgroup.files {
+		if c.deadline.expired() {
+			return
 		}
-		if val == "max" {
-			return nil
+		c.collectFile(cgroup, dir, buf, name, m)
+	}
+}
+
+// collectFile collects the file name of cgroup, read from its directory dir
+// into buf.
+func (c *cgroupCollector) collectFile(cgroup *cgroupEntry, dir cgroupfs.Dir, buf *[]byte, name string, m chan<- prometheus.Metric) {
+	if cgroup.vanished.Load() {
+		return
+	}
+	b, err := dir.ReadFile(name, (*buf)[:0])
+	*buf = b
+	if vanished(err) {
+		c.vanish(cgroup)
+		return
+	}
+	if err != nil {
+		c.report(name, reasonOpen, fmt.Errorf("failed to read file %q: %w", filepath.Join(cgroup.path, name), err))
+		return
+	}
+	c.stats.fileRead()
+
+	labels := cgroup.labels
+	key := c.fileKey(name)
+	if key != name {
+		// files matching a pattern are told apart by their name
+		labels = append([]string{name}, labels...)
+	}
+	if col, ok := cgroup.singleCollectors[key]; ok {
+		err = col.collect(b, labels, col.desc, m)
+	}
+	if col, ok := cgroup.multipleCollectors[key]; ok {
+		err = col.collect(b, labels, col.descs, m)
+	}
+
+	if vanished(err) {
+		c.vanish(cgroup)
+		return
+	}
+	if err != nil {
+		c.report(name, reasonParse, fmt.Errorf("failed to parse file %q: %w", filepath.Join(cgroup.path, name), err))
+	}
+}
+
+// includeLayers returns the sets of include patterns a path has to be
+// included by: the configured ones and those of the filter, if any.
+func (c *cgroupCollector) includeLayers() [][]pattern {
+	if c.filterIncludes == nil {
+		return [][]pattern{c.includes}
+	}
+	return [][]pattern{c.includes, c.filterIncludes}
+}
+
+// included returns whether path is included by each include layer, given
+// whether its parent is, and whether it is included by all of them.
+func (c *cgroupCollector) included(parent []bool, path string) ([]bool, bool) {
+	layers := c.includeLayers()
+	included := make([]bool, len(layers))
+	all := true
+	for i, layer := range layers {
+		included[i] = (parent != nil && parent[i]) || matchAny(layer, path)
+		all = all && included[i]
+	}
+	return included, all
+}
+
+// matchAnyBelow reports whether any of the patterns could match a path below
+// dir.
+func matchAnyBelow(patterns []pattern, dir string) bool {
+	for _, p := range patterns {
+		if p.matchBelow(dir) {
+			return true
 		}
-		var value float64
-		value, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			return fmt.Errorf("failed to parse value %q: %w", val, err)
+	}
+	return false
+}
+
+// matchAny reports whether any of the patterns matches name.
+func matchAny(patterns []pattern, name string) bool {
+	for _, p := range patterns {
+		if p.match(name) {
+			return true
 		}
-		m <- prometheus.MustNewConstMetric(desc, valueType, value, path)
-		return nil
 	}
+	return false
+}
+
+// scrape holds the state of a single call to Collect.
+type scrape struct {
+	// due are the background schedules that are due, if the scrape only
+	// looks for their cgroups.
+	due []bool
+	// included holds for the directories walked so far whether they are
+	// included by each include layer.
+	included map[string][]bool
+	// idle holds the directories walked whose schedule isn't due.
+	idle map[string]bool
+	// cgroups holds the cgroups discovered so far, by path and in the order
+	// of discovery.
+	cgroups map[string]*cgroupEntry
+	order   []*cgroupEntry
+	// rollups holds the rollups that were discovered.
+	rollups map[string]bool
+}
+
+func (s *scrape) add(cgroup *cgroupEntry) {
+	s.cgroups[cgroup.path] = cgroup
+	s.order = append(s.order, cgroup)
+}
+
+// cgroupEntry is a cgroup discovered during a scrape.
+type cgroupEntry struct {
+	path   string
+	info   fs.FileInfo
+	labels []string
+	// singleCollectors and multipleCollectors are the files that may be
+	// collected for the cgroup, according to its profile.
+	singleCollectors   map[string]collector
+	multipleCollectors map[string]multipleCollector
+	// files are the names of the files to collect.
+	files []string
+	// members are the cgroups a rollup sums up. Rollups have no files of
+	// their own.
+	members []*cgroupEntry
+	// vanished is set once the cgroup was found to be removed.
+	vanished atomic.Bool
+}
+
+// cgroupEntry returns the cgroup that contains the file at path. Files matched
+// directly by the glob have no directory entry in the walk, so their cgroup is
+// discovered on demand.
+func (c *cgroupCollector) cgroupEntry(s *scrape, path string) *cgroupEntry {
+	dir := filepath.Dir(path)
+	if cgroup, ok := s.cgroups[dir]; ok {
+		return cgroup
+	}
+	info, err := fs.Stat(c.fs, dir)
+	cgroup := c.newCgroupEntry(dir, info)
+	if vanished(err) {
+		c.vanish(cgroup)
+	} else if err != nil {
+		c.report("", reasonStat, err)
+	}
+	s.add(cgroup)
+	return cgroup
+}
+
+// newCgroupEntry labels the cgroup at path and selects its profile. The
+// cgroup_info is only exported if info carries the inode number of the cgroup
+// directory, which is the case for os.DirFS.
+func (c *cgroupCollector) newCgroupEntry(path string, info fs.FileInfo) *cgroupEntry {
+	cgroup := &cgroupEntry{
+		path:               path,
+		info:               info,
+		labels:             c.labels(path),
+		singleCollectors:   c.singleCollectors,
+		multipleCollectors: c.multipleCollectors,
+	}
+	if p := c.profile(path); p != nil {
+		cgroup.singleCollectors, cgroup.multipleCollectors = p.singleCollectors, p.multipleCollectors
+	}
+	return cgroup
+}
+
+// absolutePath converts a path relative to the cgroupfs root to the absolute
+// form used by /proc/<pid>/cgroup.
+func absolutePath(path string) string {
+	if path == "." {
+		return "/"
+	}
+	return "/" + path
 }
 
-type kvVisitor func(k, v string) error
-type entryVisitor func(n string) (kvVisitor, error)
-
-// visitNestedKeyed parses r into nested key-values. The format is expected to be:
-//
-//	KEY0 SUB_KEY0=VAL00 SUB_KEY1=VAL01\n
-//	KEY1 SUB_KEY0=VAL10 SUB_KEY1=VAL11\n
-//	...
-func visitNestedKeyed(r io.Reader, visitEntry entryVisitor) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		line = strings.TrimSpace(line)
-		split := strings.Split(line, " ")
-		k := split[0]
-		vs := split[1:]
-		visitKV, err := visitEntry(k)
+// collectIOStat collects io.stat. If devices is not nil, the device numbers
+// are resolved to device labels.
+func collectIOStat(devices *deviceResolver) collectMultipleFunc {
+	return func(b []byte, labels []string, descs map[string]desc, m chan<- prometheus.Metric) error {
+		stats, err := cgroupfs.ParseIOStat(b)
 		if err != nil {
 			return err
 		}
-		for _, v := range vs {
-			kv := strings.Split(v, "=")
-			if len(kv) == 0 {
-				// some entries might not have values
-				return nil
+		for i := range stats {
+			stat := &stats[i]
+			values := []string{stat.Device}
+			if devices != nil {
+				values = append(values, devices.labels(stat.Device)...)
 			}
-			if len(kv) != 2 {
-				return fmt.Errorf("invalid key-value pair %q %q, %d", k, v, len(kv))
+			values = append(values, labels...)
+			for key, desc := range descs {
+				if value, ok := stat.Value(key); ok {
+					m <- prometheus.MustNewConstMetric(desc.desc, prometheus.CounterValue, float64(value), values...)
+				}
 			}
-			visitKV(kv[0], kv[1])
 		}
-
+		return nil
 	}
-	return scanner.Err()
 }
 
-// visitFlatKeyed parses r into key-values. The format is expected to be:
-//
-//	KEY0 VAL0\n
-//	KEY1 VAL1\n
-func visitFlatKeyed(r io.Reader, visitKV kvVisitor) error {
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		kv := strings.Split(line, " ")
-		if len(kv) != 2 {
-			return fmt.Errorf("invalid key-value pair %q", line)
-		}
-		if err := visitKV(kv[0], kv[1]); err != nil {
+// CollectSingleValue collects a file with a single value, like
+// memory.current. Files containing max, i.e. no limit, are skipped.
+func CollectSingleValue(valueType prometheus.ValueType) CollectFunc {
+	return readerFunc(collectSingle(valueType, parseValue))
+}
+
+// readerFunc returns the CollectFunc of collect, which reads the file whole.
+func readerFunc(collect collectFunc) CollectFunc {
+	return func(f io.Reader, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+		b, err := io.ReadAll(f)
+		if err != nil {
 			return err
 		}
+		return collect(b, labels, desc, m)
+	}
+}
+
+// KVVisitor visits a key-value pair of a file.
+type KVVisitor = cgroupfs.KVVisitor
+
+// EntryVisitor visits the key of a line of a nested-keyed file and returns the
+// visitor of its key-value pairs.
+type EntryVisitor = cgroupfs.EntryVisitor
+
+// VisitNestedKeyed reads r and parses it with cgroupfs.VisitNestedKeyed.
+func VisitNestedKeyed(r io.Reader, visitEntry EntryVisitor) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return cgroupfs.VisitNestedKeyed(b, visitEntry)
+}
+
+// VisitFlatKeyed reads r and parses it with cgroupfs.VisitFlatKeyed.
+func VisitFlatKeyed(r io.Reader, visitKV KVVisitor) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
 	}
-	return scanner.Err()
+	return cgroupfs.VisitFlatKeyed(b, visitKV)
 }
 
-// collectFlatKeyed collects a file with multiple key-value pairs.
-func collectFlatKeyed(valueType prometheus.ValueType) collectMultipleFunc {
-	return func(f io.Reader, path string, descs map[string]desc, m chan<- prometheus.Metric) error {
-		return visitFlatKeyed(f, func(k, v string) error {
-			desc, ok := descs[k]
+// stat is a flat-keyed file parsed by cgroupfs into S.
+type stat[S any] interface {
+	*S
+	Value(key string) (uint64, bool)
+}
+
+// collectStat collects a flat-keyed file parsed by parse, with one metric per
+// key found in the file.
+func collectStat[S any, P stat[S]](parse func([]byte) (S, error), valueType prometheus.ValueType) collectMultipleFunc {
+	return func(b []byte, labels []string, descs map[string]desc, m chan<- prometheus.Metric) error {
+		s, err := parse(b)
+		if err != nil {
+			return err
+		}
+		for key, desc := range descs {
+			v, ok := P(&s).Value(key)
 			if !ok {
-				// silently skip unknown keys
-				return nil
-			}
-			value, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				return fmt.Errorf("failed to parse value %q: %w", v, err)
+				continue
 			}
+			value := float64(v)
 			if desc.modifier != nil {
 				value = desc.modifier(value)
 			}
-			m <- prometheus.MustNewConstMetric(desc.desc, valueType, value, path)
-			return nil
-		})
+			m <- prometheus.MustNewConstMetric(desc.desc, valueType, value, labels...)
+		}
+		return nil
 	}
 }
 
 // collectPressure collects a file with pressure values. Currently only total is collected as the
 // other values can easily be derived from the time-series data.
-func collectPressure(f io.Reader, path string, descs map[string]desc, m chan<- prometheus.Metric) error {
-
-	return visitNestedKeyed(f, func(n string) (kvVisitor, error) {
-		desc, ok := descs[n]
-		if !ok {
-			return nil, fmt.Errorf("unknown pressure type %q", n)
+func collectPressure(b []byte, labels []string, descs map[string]desc, m chan<- prometheus.Metric) error {
+	psi, err := cgroupfs.ParsePSI(b)
+	if err != nil {
+		return err
+	}
+	lines := []struct {
+		name  string
+		stats *cgroupfs.PSIStats
+	}{{"some", &psi.Some}, {"full", psi.Full}}
+	for _, line := range lines {
+		desc, ok := descs[line.name]
+		if !ok || line.stats == nil {
+			continue
+		}
+		value := float64(line.stats.Total)
+		if desc.modifier != nil {
+			value = desc.modifier(value)
 		}
+		m <- prometheus.MustNewConstMetric(desc.desc, prometheus.CounterValue, value, labels...)
+	}
+	return nil
+}
 
-		return func(k, v string) error {
-			if k == "total" {
-				value, err := strconv.ParseFloat(v, 64)
-				if err != nil {
-					return fmt.Errorf("failed to parse value %q: %w", v, err)
-				}
-				if desc.modifier != nil {
-					value = desc.modifier(value)
-				}
-				m <- prometheus.MustNewConstMetric(desc.desc, prometheus.CounterValue, value, path)
+// descs returns the descriptors of all metrics the collector may export.
+func (c *cgroupCollector) descs() []*prometheus.Desc {
+	descs := []*prometheus.Desc{c.info}
+	if c.selfMetrics {
+		descs = append(descs, c.stats.descs()...)
+	}
+	if c.invocations != nil {
+		descs = append(descs, c.invocations.info, c.invocations.changes)
+	}
+	if c.limits != nil {
+		descs = append(descs, c.limits.seriesLimitHits, c.limits.droppedCgroups)
+	}
+	descs = append(descs, tableDescs(c.singleCollectors, c.multipleCollectors)...)
+	for _, p := range c.profiles {
+		// profiles may collect files that are not collected by default
+		for _, d := range tableDescs(p.singleCollectors, p.multipleCollectors) {
+			if !slices.Contains(descs, d) {
+				descs = append(descs, d)
 			}
-			return nil
-		}, nil
-	})
+		}
+	}
+	return descs
 }
 
-// Describe implements prometheus.Collector.
+// Describe implements prometheus.Collector. It sends the descriptors built by
+// New, without walking the hierarchy.
 func (c *cgroupCollector) Describe(d chan<- *prometheus.Desc) {
-	prometheus.DescribeByCollect(c, d)
+	for _, desc := range c.descs() {
+		d <- desc
+	}
 }
 
 var _ prometheus.Collector = &cgroupCollector{}
@@ -16,7 +16,10 @@ import (
 var cgroup embed.FS
 
 func TestCanCollectWholeCgroupTree(t *testing.T) {
-	c := New(cgroup, "")
+	c := New(cgroup, "").(*cgroupCollector)
+	c.errorHandler = func(err error) {
+		t.Error(err)
+	}
 	metrics := make(chan prometheus.Metric)
 	go func() {
 		defer close(metrics)
@@ -24,7 +27,6 @@ func TestCanCollectWholeCgroupTree(t *testing.T) {
 	}()
 	for range metrics {
 	}
-	// TODO How to make sure no errors were logged.
 }
 
 /*(func FuzzCgroupTree(f *testing.F) {
@@ -149,7 +151,7 @@ full avg10=0.00 avg60=0.00 avg300=0.00 total=0
 `
 	r := strings.NewReader(pressure)
 
-	err := visitNestedKeyed(r, func(n string) (kvVisitor, error) {
+	err := VisitNestedKeyed(r, func(n string) (KVVisitor, error) {
 		return func(k, v string) error {
 			switch n {
 			case "some":
@@ -239,7 +241,7 @@ func TestCanParseRootIOStart(t *testing.T) {
 	ms := make(chan prometheus.Metric)
 	go func() {
 		defer close(ms)
-		if err := collectIOStat(strings.NewReader(iostat), ".", c.multipleCollectors["io.stat"].descs, ms); err != nil {
+		if err := collectIOStat(nil)([]byte(iostat), []string{"."}, c.multipleCollectors["io.stat"].descs, ms); err != nil {
 			t.Error(err)
 		}
 
@@ -258,3 +260,53 @@ func TestCanParseRootIOStart(t *testing.T) {
 	}
 
 }
+
+// nofs fails the test when it is used.
+type nofs struct {
+	t *testing.T
+}
+
+func (n nofs) Open(name string) (fs.File, error) {
+	n.t.Errorf("should not open %s", name)
+	return nil, fs.ErrNotExist
+}
+
+func TestDescribeDoesntWalk(t *testing.T) {
+	c := New(nofs{t}, "")
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		defer close(descs)
+		c.Describe(descs)
+	}()
+	n := 0
+	for range descs {
+		n++
+	}
+	if n < len(Metrics()) {
+		t.Errorf("expected at least %d descriptors got %d", len(Metrics()), n)
+	}
+}
+
+func TestCollectsOnlyDescribedMetrics(t *testing.T) {
+	c := New(cgroup, "fixtures/cgroup",
+		WithFiles("memory.current"),
+		WithProfiles([]Profile{{Match: "fixtures/cgroup/system.slice", Selection: Selection{Enable: []string{"cpu.stat"}}}}),
+		WithRollups("fixtures/cgroup/system.slice/*.mount"),
+		WithLimits(Limits{MaxSeries: 1000}),
+	)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cpu bool
+	for _, family := range families {
+		cpu = cpu || family.GetName() == "cgroup_cpu_usage_seconds_total"
+	}
+	if !cpu {
+		t.Error("expected the cpu.stat metrics of the profile")
+	}
+}
@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Config is the configuration file of the exporter. It is JSON encoded.
+type Config struct {
+	// LabelRules derive labels from cgroup paths.
+	LabelRules []LabelRule `json:"label_rules"`
+	// Collectors selects the files to collect.
+	Collectors Selection `json:"collectors"`
+	// Profiles select what to collect per subtree of the hierarchy.
+	Profiles []Profile `json:"profiles"`
+	// Files declares how to collect files the exporter doesn't support
+	// itself.
+	Files []FileCollector `json:"files"`
+	// Rollups sum up transient sibling cgroups matching a pattern.
+	Rollups []string `json:"rollups"`
+	// Limits bound what is exported per scrape.
+	Limits Limits `json:"limits"`
+	// Schedules set how often subtrees are collected when collecting in the
+	// background.
+	Schedules []Schedule `json:"schedules"`
+}
+
+// LoadConfig reads and validates the configuration file name.
+func LoadConfig(name string) (*Config, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var config Config
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", name, err)
+	}
+	return &config, nil
+}
+
+func (c *Config) validate() error {
+	if _, err := c.Collectors.Files(); err != nil {
+		return fmt.Errorf("collectors: %w", err)
+	}
+	metrics := make(map[string]bool)
+	for i, fc := range c.Files {
+		if err := fc.validate(); err != nil {
+			return fmt.Errorf("file %d: %w", i, err)
+		}
+		names := []string{fc.Metric}
+		for _, name := range fc.Metrics {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			if name != "" && metrics[name] {
+				return fmt.Errorf("file %d: metric %q is declared twice", i, name)
+			}
+			metrics[name] = true
+		}
+	}
+	for i, schedule := range c.Schedules {
+		if err := schedule.validate(); err != nil {
+			return fmt.Errorf("schedule %d: %w", i, err)
+		}
+	}
+	for _, rollup := range c.Rollups {
+		if err := validateRollup(rollup); err != nil {
+			return fmt.Errorf("rollups: %w", err)
+		}
+	}
+	if err := c.Limits.validate(); err != nil {
+		return fmt.Errorf("limits: %w", err)
+	}
+	for i, profile := range c.Profiles {
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("profile %d: %w", i, err)
+		}
+	}
+	ruleLabels := make(map[string]bool)
+	for i, rule := range c.LabelRules {
+		if rule.Match.Regexp == nil {
+			return fmt.Errorf("label rule %d: match is required", i)
+		}
+		for name := range rule.Labels {
+			if !labelName.MatchString(name) {
+				return fmt.Errorf("label rule %d: invalid label name %q", i, name)
+			}
+			if slices.Contains(reservedLabels, name) {
+				return fmt.Errorf("label rule %d: label %q is reserved", i, name)
+			}
+			ruleLabels[name] = true
+		}
+	}
+	for i, fc := range c.Files {
+		if fc.Format == "nested-keyed" && ruleLabels[fc.label()] {
+			return fmt.Errorf("file %d: label %q is set by a label rule", i, fc.label())
+		}
+	}
+	return nil
+}
+
+// Options returns the collector options that implement the configuration.
+func (c *Config) Options() ([]Option, error) {
+	var opts []Option
+	if len(c.LabelRules) > 0 {
+		opts = append(opts, WithLabelRules(c.LabelRules))
+	}
+	if !c.Collectors.isZero() {
+		files, err := c.Collectors.Files()
+		if err != nil {
+			return nil, fmt.Errorf("collectors: %w", err)
+		}
+		opts = append(opts, WithFiles(files...))
+	}
+	if len(c.Profiles) > 0 {
+		opts = append(opts, WithProfiles(c.Profiles))
+	}
+	if len(c.Files) > 0 {
+		opts = append(opts, WithFileCollectors(c.Files...))
+	}
+	if len(c.Rollups) > 0 {
+		for _, rollup := range c.Rollups {
+			if err := validateRollup(rollup); err != nil {
+				return nil, fmt.Errorf("rollups: %w", err)
+			}
+		}
+		opts = append(opts, WithRollups(c.Rollups...))
+	}
+	if !c.Limits.isZero() {
+		opts = append(opts, WithLimits(c.Limits))
+	}
+	return opts, nil
+}
+
+// labelName matches valid Prometheus label names.
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are set by the exporter itself and can't be set by label
+// rules.
+var reservedLabels = []string{
+	"cgroup", "device", "cgroup_id", "path", "invocation_id", "file",
+	"runtime", "container_id", "container_name", "container_image",
+	"device_name", "rotational", "model",
+	"uid", "user",
+	"machine", "machine_class",
+}
+
+// Regexp is a regular expression that is anchored at both ends and is
+// encoded as a string in the configuration file.
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// NewRegexp compiles an anchored regular expression.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{re}, err
+}
+
+func (r *Regexp) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	re, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*r = re
+	return nil
+}
+
+// Duration is a duration encoded as a string like 15s or 1m30s in the
+// configuration file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(name, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `{
+		"label_rules": [
+			{"match": "ci\\.slice/runner-(\\d+)\\.scope", "labels": {"runner": "$1"}}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.LabelRules) != 1 || !config.LabelRules[0].Match.MatchString("ci.slice/runner-1.scope") {
+		t.Errorf("unexpected label rules %+v", config.LabelRules)
+	}
+	opts, err := config.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts) != 1 {
+		t.Errorf("expected 1 option got %d", len(opts))
+	}
+}
+
+func TestLoadConfigRejectsInvalidConfigs(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":      `{"label_rule": []}`,
+		"invalid regexp":     `{"label_rules": [{"match": "(", "labels": {"a": "b"}}]}`,
+		"missing match":      `{"label_rules": [{"labels": {"a": "b"}}]}`,
+		"invalid label name": `{"label_rules": [{"match": ".*", "labels": {"a-b": "c"}}]}`,
+		"reserved label":     `{"label_rules": [{"match": ".*", "labels": {"cgroup": "c"}}]}`,
+	}
+	for name, config := range tests {
+		if _, err := LoadConfig(writeConfig(t, config)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
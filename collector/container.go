@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// containerScopes recognises the cgroup names container runtimes create for
+// their containers. The first submatch is the container ID.
+var containerScopes = []struct {
+	runtime string
+	re      *regexp.Regexp
+}{
+	{"docker", regexp.MustCompile(`^docker-([0-9a-f]{64})\.scope$`)},
+	{"podman", regexp.MustCompile(`^libpod-([0-9a-f]{64})\.scope$`)},
+	{"containerd", regexp.MustCompile(`^cri-containerd-([0-9a-f]{64})\.scope$`)},
+	{"lxc", regexp.MustCompile(`^lxc\.payload\.(.+)$`)},
+}
+
+// containerID matches the bare container ID directories created by the
+// cgroupfs cgroup driver, e.g. docker/<id>.
+var containerID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// parseContainer returns the runtime and container ID of the container that
+// cgroup belongs to. Cgroups nested inside a container, such as the
+// units of a container running systemd, belong to that container.
+func parseContainer(cgroup string) (runtime, id string, ok bool) {
+	elems := strings.Split(cgroup, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		for _, s := range containerScopes {
+			if m := s.re.FindStringSubmatch(elems[i]); m != nil {
+				return s.runtime, m[1], true
+			}
+		}
+		if i > 0 && elems[i-1] == "docker" && containerID.MatchString(elems[i]) {
+			return "docker", elems[i], true
+		}
+	}
+	return "", "", false
+}
+
+// dockerConfig is the subset of /var/lib/docker/containers/<id>/config.v2.json
+// that is needed to name a container.
+type dockerConfig struct {
+	Name   string
+	Config struct {
+		Image string
+	}
+}
+
+// containerResolver looks up the names and images of containers in the
+// on-disk state of their runtime below root, the host filesystem. Only Docker
+// keeps its state in a readable format; LXC containers are named by their
+// cgroup. The state of a container is parsed again whenever its modification
+// time or size changes, and forgotten once no cgroup of the container is
+// labeled during a scrape.
+type containerResolver struct {
+	root fs.FS
+	// report reports the errors reading the state of containers.
+	report func(file string, err error)
+
+	mu         sync.Mutex
+	scrape     uint64
+	containers map[string]containerState
+}
+
+type containerState struct {
+	modTime     time.Time
+	size        int64
+	name, image string
+	scrape      uint64
+}
+
+// newScrape forgets the containers that were not resolved since the last
+// scrape.
+func (r *containerResolver) newScrape() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, c := range r.containers {
+		if c.scrape != r.scrape {
+			delete(r.containers, id)
+		}
+	}
+	r.scrape++
+}
+
+func (r *containerResolver) resolve(runtime, id string) (name, image string) {
+	switch runtime {
+	case "docker":
+		return r.resolveDocker(id)
+	case "lxc":
+		return id, ""
+	}
+	return "", ""
+}
+
+// resolveDocker returns the name and image of the Docker container id. The
+// config is read without holding r.mu, so a slow disk doesn't hold up the
+// other cgroups.
+func (r *containerResolver) resolveDocker(id string) (name, image string) {
+	file := path.Join("var/lib/docker/containers", id, "config.v2.json")
+	info, err := fs.Stat(r.root, file)
+	if err != nil {
+		slog.Debug("failed to open container config", "id", id, "error", err)
+		r.mu.Lock()
+		delete(r.containers, id)
+		r.mu.Unlock()
+		return "", ""
+	}
+	r.mu.Lock()
+	c, ok := r.containers[id]
+	r.mu.Unlock()
+	if !ok || !info.ModTime().Equal(c.modTime) || info.Size() != c.size {
+		c = containerState{modTime: info.ModTime(), size: info.Size()}
+		config, err := readDockerConfig(r.root, file)
+		if err != nil {
+			// reported once, until the config changes
+			r.report("config.v2.json", fmt.Errorf("failed to decode config of container %s: %w", id, err))
+		} else {
+			c.name, c.image = strings.TrimPrefix(config.Name, "/"), config.Config.Image
+		}
+	}
+	r.mu.Lock()
+	c.scrape = r.scrape
+	r.containers[id] = c
+	r.mu.Unlock()
+	return c.name, c.image
+}
+
+func readDockerConfig(root fs.FS, file string) (*dockerConfig, error) {
+	f, err := root.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var config dockerConfig
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// WithContainerLabels adds runtime and container_id labels to cgroups that
+// belong to a Docker, Podman, LXC/Incus or containerd container. If root is
+// not nil, container_name and container_image are resolved from the
+// runtime's state below root, which should be the host's root directory.
+func WithContainerLabels(root fs.FS) Option {
+	return func(c *cgroupCollector) {
+		names := []string{"runtime", "container_id"}
+		var resolver *containerResolver
+		var newScrape func()
+		if root != nil {
+			names = append(names, "container_name", "container_image")
+			resolver = &containerResolver{root: root, containers: make(map[string]containerState), report: c.labelErrorReporter()}
+			newScrape = resolver.newScrape
+		}
+		c.labelers = append(c.labelers, labeler{
+			names: names,
+			values: func(cgroup string) []string {
+				values := make([]string, len(names))
+				runtime, id, ok := parseContainer(cgroup)
+				if !ok {
+					return values
+				}
+				values[0], values[1] = runtime, id
+				if resolver != nil {
+					values[2], values[3] = resolver.resolve(runtime, id)
+				}
+				return values
+			},
+			newScrape: newScrape,
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+const dockerID = "3f4e1d2c5b6a79880f1e2d3c4b5a69788f9e0d1c2b3a49586f7e8d9c0b1a2938"
+
+func TestParseContainer(t *testing.T) {
+	tests := []struct {
+		cgroup  string
+		runtime string
+		id      string
+	}{
+		{"system.slice/docker-" + dockerID + ".scope", "docker", dockerID},
+		{"docker/" + dockerID, "docker", dockerID},
+		{"machine.slice/libpod-" + dockerID + ".scope", "podman", dockerID},
+		{"machine.slice/libpod-" + dockerID + ".scope/container", "podman", dockerID},
+		{"kubepods.slice/kubepods-pod1.slice/cri-containerd-" + dockerID + ".scope", "containerd", dockerID},
+		{"lxc.payload.web01", "lxc", "web01"},
+		{"lxc.payload.web01/system.slice/nginx.service", "lxc", "web01"},
+		{"system.slice/docker.service", "", ""},
+		{"machine.slice/libpod-conmon-" + dockerID + ".scope", "", ""},
+	}
+	for _, tt := range tests {
+		runtime, id, _ := parseContainer(tt.cgroup)
+		if runtime != tt.runtime || id != tt.id {
+			t.Errorf("%s: expected %q %q got %q %q", tt.cgroup, tt.runtime, tt.id, runtime, id)
+		}
+	}
+}
+
+func TestContainerLabels(t *testing.T) {
+	cgroupfs := fstest.MapFS{
+		"system.slice/docker-" + dockerID + ".scope/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	root := fstest.MapFS{
+		"var/lib/docker/containers/" + dockerID + "/config.v2.json": &fstest.MapFile{Data: []byte(`{"Name":"/web","Config":{"Image":"nginx:1.27"}}`)},
+	}
+	c := New(cgroupfs, "", WithContainerLabels(root))
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+
+	metric := <-metrics
+	if metric == nil {
+		t.Fatal("expected metric")
+	}
+	dto := new(io_prometheus_client.Metric)
+	metric.Write(dto)
+
+	expected := map[string]string{
+		"cgroup":          "system.slice/docker-" + dockerID + ".scope",
+		"runtime":         "docker",
+		"container_id":    dockerID,
+		"container_name":  "web",
+		"container_image": "nginx:1.27",
+	}
+	for _, l := range dto.Label {
+		if expected[*l.Name] != *l.Value {
+			t.Errorf("expected %s=%q got %q", *l.Name, expected[*l.Name], *l.Value)
+		}
+		delete(expected, *l.Name)
+	}
+	for name := range expected {
+		t.Errorf("missing label %s", name)
+	}
+	for range metrics {
+	}
+}
+
+func TestContainerStateIsCached(t *testing.T) {
+	file := "var/lib/docker/containers/" + dockerID + "/config.v2.json"
+	root := fstest.MapFS{
+		file: &fstest.MapFile{Data: []byte(`{"Name":"/web","Config":{"Image":"nginx:1.27"}}`)},
+	}
+	var reported []string
+	r := &containerResolver{root: root, containers: make(map[string]containerState), report: func(file string, err error) {
+		reported = append(reported, file)
+	}}
+	if name, image := r.resolve("docker", dockerID); name != "web" || image != "nginx:1.27" {
+		t.Errorf("expected web nginx:1.27 got %q %q", name, image)
+	}
+	// same size and modification time, so the config isn't decoded again
+	root[file].Data = []byte(`{"Name":"/api","Config":{"Image":"nginx:1.27"}}`)
+	if name, _ := r.resolve("docker", dockerID); name != "web" {
+		t.Errorf("expected the cached name got %q", name)
+	}
+	root[file].Data = []byte(`{"Name":"/proxy","Config":{"Image":"nginx:1.27"}}`)
+	if name, _ := r.resolve("docker", dockerID); name != "proxy" {
+		t.Errorf("expected the config to be decoded again got %q", name)
+	}
+	root[file].Data = []byte(`{"Name":`)
+	if name, _ := r.resolve("docker", dockerID); name != "" || len(r.containers) != 1 {
+		t.Errorf("expected the broken config to be cached without a name got %q", name)
+	}
+	r.resolve("docker", dockerID)
+	if len(reported) != 1 || reported[0] != "config.v2.json" {
+		t.Errorf("expected the broken config to be reported once got %q", reported)
+	}
+	delete(root, file)
+	if name, _ := r.resolve("docker", dockerID); name != "" || len(r.containers) != 0 {
+		t.Errorf("expected the removed container to be forgotten got %q", name)
+	}
+
+	root[file] = &fstest.MapFile{Data: []byte(`{"Name":"/web","Config":{"Image":"nginx:1.27"}}`)}
+	r.resolve("docker", dockerID)
+	r.newScrape()
+	if len(r.containers) != 1 {
+		t.Error("expected the container resolved during the last scrape to be kept")
+	}
+	r.newScrape()
+	if len(r.containers) != 0 {
+		t.Error("expected the container not resolved during the last scrape to be forgotten")
+	}
+}
@@ -0,0 +1,352 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/arianvp/cgroup-exporter/cgroupfs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FileCollector declares how to collect a cgroup file the exporter doesn't
+// support itself, so new kernel files can be exported without a release.
+type FileCollector struct {
+	// File is the name of the file, like memory.numa_stat, or a path.Match
+	// pattern of names, like hugetlb.*.current. The metrics of the files
+	// matching a pattern have a file label with the name of the file.
+	File string `json:"file"`
+	// Format is the format of the file, as described by the cgroup v2
+	// documentation:
+	//
+	//	single        VAL
+	//	flat-keyed    KEY VAL, one per line
+	//	nested-keyed  KEY SUB_KEY=VAL ..., one per line
+	//	range-list    0-3,8, exported as the number of elements
+	Format string `json:"format"`
+	// Type is gauge, the default, or counter.
+	Type string `json:"type"`
+	// Scale multiplies the values, e.g. 1e-6 converts microseconds to seconds.
+	Scale float64 `json:"scale"`
+	// Max is how values of "max", meaning no limit, are exported: skip, the
+	// default, inf for +Inf, or a number.
+	Max string `json:"max"`
+	// Metric is the name of the metric of single and range-list files.
+	Metric string `json:"metric"`
+	// Metrics maps the keys of flat-keyed files and the sub-keys of
+	// nested-keyed files to metric names. Other keys are skipped.
+	Metrics map[string]string `json:"metrics"`
+	// Label is the name of the label holding the key of the lines of
+	// nested-keyed files. The default is key.
+	Label string `json:"label"`
+	// Help is the help text of the metrics.
+	Help string `json:"help"`
+}
+
+// metricName matches valid Prometheus metric names.
+var metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+func (fc FileCollector) pattern() bool {
+	return strings.ContainsAny(fc.File, `*?[\`)
+}
+
+func (fc FileCollector) label() string {
+	if fc.Label == "" {
+		return "key"
+	}
+	return fc.Label
+}
+
+func (fc FileCollector) validate() error {
+	if fc.File == "" || strings.Contains(fc.File, "/") {
+		return fmt.Errorf("invalid file %q", fc.File)
+	}
+	if _, err := path.Match(fc.File, ""); err != nil {
+		return fmt.Errorf("invalid file %q: %w", fc.File, err)
+	}
+	if slices.Contains(supportedFiles, fc.File) {
+		return fmt.Errorf("file %q is supported already", fc.File)
+	}
+	if fc.Type != "" && fc.Type != "gauge" && fc.Type != "counter" {
+		return fmt.Errorf("unknown type %q", fc.Type)
+	}
+	if _, err := fc.parser(); err != nil {
+		return err
+	}
+	var names []string
+	switch fc.Format {
+	case "single", "range-list":
+		names = []string{fc.Metric}
+	case "flat-keyed", "nested-keyed":
+		if len(fc.Metrics) == 0 {
+			return fmt.Errorf("metrics are required for %s files", fc.Format)
+		}
+		for _, name := range fc.Metrics {
+			names = append(names, name)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", fc.Format)
+	}
+	for _, name := range names {
+		if !metricName.MatchString(name) {
+			return fmt.Errorf("invalid metric name %q", name)
+		}
+		if slices.Contains(supportedMetrics, name) {
+			return fmt.Errorf("metric %q is exported already", name)
+		}
+	}
+	if fc.Format == "nested-keyed" {
+		if !labelName.MatchString(fc.label()) {
+			return fmt.Errorf("invalid label name %q", fc.label())
+		}
+		if slices.Contains(reservedLabels, fc.label()) {
+			return fmt.Errorf("label %q is reserved", fc.label())
+		}
+	}
+	return nil
+}
+
+// valueParser parses a value of a file. It returns false for values that are
+// skipped.
+type valueParser func(v string) (float64, bool, error)
+
+func (fc FileCollector) parser() (valueParser, error) {
+	scale := fc.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	skipMax, maxValue := true, 0.0
+	switch fc.Max {
+	case "", "skip":
+	case "inf":
+		skipMax, maxValue = false, math.Inf(1)
+	default:
+		value, err := strconv.ParseFloat(fc.Max, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max %q", fc.Max)
+		}
+		skipMax, maxValue = false, value
+	}
+	return func(v string) (float64, bool, error) {
+		if v == "max" {
+			return maxValue, !skipMax, nil
+		}
+		value, ok, err := parseValue(v)
+		return value * scale, ok, err
+	}, nil
+}
+
+// parseValue is the valueParser of the files of the exporter and of the
+// collect functions of extensions: values are not scaled, and max, i.e. no
+// limit, is skipped.
+func parseValue(v string) (float64, bool, error) {
+	if v == "max" {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse value %q: %w", v, err)
+	}
+	return value, true, nil
+}
+
+// addFileCollector adds the collector of fc to the tables of c and of its
+// profiles, as declared files are always collected.
+func (c *cgroupCollector) addFileCollector(fc FileCollector, newDesc func(name, help string, variableLabels ...string) *prometheus.Desc) error {
+	if err := fc.validate(); err != nil {
+		return err
+	}
+	parse, _ := fc.parser()
+	valueType := prometheus.GaugeValue
+	if fc.Type == "counter" {
+		valueType = prometheus.CounterValue
+	}
+	var labels []string
+	if fc.Format == "nested-keyed" {
+		if c.setsLabel(fc.label()) {
+			return fmt.Errorf("label %q is set by the collector", fc.label())
+		}
+		labels = append(labels, fc.label())
+	}
+	if fc.pattern() {
+		labels = append(labels, "file")
+		c.filePatterns = append(c.filePatterns, fc.File)
+	}
+
+	var single collector
+	var multiple multipleCollector
+	switch fc.Format {
+	case "single":
+		single = collector{desc: newDesc(fc.Metric, fc.Help, labels...), collect: collectSingle(valueType, parse)}
+	case "range-list":
+		single = collector{desc: newDesc(fc.Metric, fc.Help, labels...), collect: collectRangeList}
+	case "flat-keyed", "nested-keyed":
+		multiple = multipleCollector{descs: make(map[string]desc)}
+		for key, name := range fc.Metrics {
+			multiple.descs[key] = desc{desc: newDesc(name, fc.Help, labels...)}
+		}
+		multiple.collect = collectKeyed(valueType, parse)
+		if fc.Format == "nested-keyed" {
+			multiple.collect = collectNestedKeyed(valueType, parse)
+		}
+	}
+	c.addCollector(fc.File, single, multiple)
+	return nil
+}
+
+// addCollector adds the collector of file, single or multiple, to the tables
+// of c and of its profiles.
+func (c *cgroupCollector) addCollector(file string, single collector, multiple multipleCollector) {
+	tables := []map[string]collector{c.singleCollectors}
+	multipleTables := []map[string]multipleCollector{c.multipleCollectors}
+	for _, p := range c.profiles {
+		tables = append(tables, p.singleCollectors)
+		multipleTables = append(multipleTables, p.multipleCollectors)
+	}
+	if single.desc != nil {
+		for _, table := range tables {
+			table[file] = single
+		}
+	} else {
+		for _, table := range multipleTables {
+			table[file] = multiple
+		}
+	}
+}
+
+// fileKey returns the key of the collector of the file name in the tables of
+// c: the name itself, or the first declared pattern it matches.
+func (c *cgroupCollector) fileKey(name string) string {
+	if _, ok := c.singleCollectors[name]; ok {
+		return name
+	}
+	if _, ok := c.multipleCollectors[name]; ok {
+		return name
+	}
+	for _, p := range c.filePatterns {
+		if ok, _ := path.Match(p, name); ok {
+			return p
+		}
+	}
+	return name
+}
+
+// declared reports whether file is the file or pattern of a declared
+// collector or of an extension.
+func (c *cgroupCollector) declared(file string) bool {
+	return slices.ContainsFunc(c.fileCollectors, func(fc FileCollector) bool { return fc.File == file }) ||
+		slices.ContainsFunc(c.extensions, func(e extension) bool { return e.file == file })
+}
+
+// collectSingle collects a file with a single value.
+func collectSingle(valueType prometheus.ValueType, parse valueParser) collectFunc {
+	return func(b []byte, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+		v, _, _ := bytes.Cut(bytes.TrimSpace(b), []byte(" "))
+		value, ok, err := parse(string(v))
+		if err != nil || !ok {
+			return err
+		}
+		m <- prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+		return nil
+	}
+}
+
+// collectRangeList collects the number of elements of a file with a list of
+// ranges, like cpuset.cpus.effective.
+func collectRangeList(b []byte, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+	n, err := rangeListLen(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+	m <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(n), labels...)
+	return nil
+}
+
+// rangeListLen returns the number of elements of a list of ranges like
+// 0-3,8.
+func rangeListLen(s string) (int, error) {
+	n := 0
+	if s == "" {
+		return n, nil
+	}
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q", r)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return 0, fmt.Errorf("invalid range %q", r)
+			}
+		}
+		n += last - first + 1
+	}
+	return n, nil
+}
+
+// collectKeyed collects a flat-keyed file.
+func collectKeyed(valueType prometheus.ValueType, parse valueParser) collectMultipleFunc {
+	return func(b []byte, labels []string, descs map[string]desc, m chan<- prometheus.Metric) error {
+		return collectFlatKeyed(b, valueType, parse, func(key string) *prometheus.Desc { return descs[key].desc }, labels, m)
+	}
+}
+
+// collectFlatKeyed collects the flat-keyed file b with one metric per key
+// metric returns the descriptor of. Keys without a descriptor are skipped.
+func collectFlatKeyed(b []byte, valueType prometheus.ValueType, parse valueParser, metric func(key string) *prometheus.Desc, labels []string, m chan<- prometheus.Metric) error {
+	return cgroupfs.VisitFlatKeyed(b, func(k, v string) error {
+		desc := metric(k)
+		if desc == nil {
+			return nil
+		}
+		value, ok, err := parse(v)
+		if err != nil || !ok {
+			return err
+		}
+		m <- prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+		return nil
+	})
+}
+
+// collectNestedKeyed collects a nested-keyed file. The key of each line is
+// the first label value.
+func collectNestedKeyed(valueType prometheus.ValueType, parse valueParser) collectMultipleFunc {
+	return func(b []byte, labels []string, descs map[string]desc, m chan<- prometheus.Metric) error {
+		return collectNestedKeyedFile(b, valueType, parse, func(key string) *prometheus.Desc { return descs[key].desc }, labels, m)
+	}
+}
+
+// collectNestedKeyedFile collects the nested-keyed file b like
+// collectFlatKeyed, with the key of each line as the first label value.
+func collectNestedKeyedFile(b []byte, valueType prometheus.ValueType, parse valueParser, metric func(key string) *prometheus.Desc, labels []string, m chan<- prometheus.Metric) error {
+	return cgroupfs.VisitNestedKeyed(b, func(n string) (KVVisitor, error) {
+		values := append([]string{n}, labels...)
+		return func(k, v string) error {
+			desc := metric(k)
+			if desc == nil {
+				return nil
+			}
+			value, ok, err := parse(v)
+			if err != nil || !ok {
+				return err
+			}
+			m <- prometheus.MustNewConstMetric(desc, valueType, value, values...)
+			return nil
+		}, nil
+	})
+}
+
+// WithFileCollectors collects the declared files. Invalid declarations are
+// logged and skipped.
+func WithFileCollectors(collectors ...FileCollector) Option {
+	return func(c *cgroupCollector) {
+		c.fileCollectors = append(c.fileCollectors, collectors...)
+	}
+}
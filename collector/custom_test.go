@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestFileCollectors(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.peak":           &fstest.MapFile{Data: []byte("4096\n")},
+		"system.slice/cpu.max.burst":         &fstest.MapFile{Data: []byte("max\n")},
+		"system.slice/cpuset.cpus.effective": &fstest.MapFile{Data: []byte("0-3,8\n")},
+		"system.slice/cpu.stat.local":        &fstest.MapFile{Data: []byte("throttled_usec 1500000\n")},
+		"system.slice/rdma.current":          &fstest.MapFile{Data: []byte("mlx4_0 hca_handle=2 hca_object=2000\n")},
+		"system.slice/hugetlb.2MB.current":   &fstest.MapFile{Data: []byte("2097152\n")},
+		"system.slice/hugetlb.1GB.current":   &fstest.MapFile{Data: []byte("0\n")},
+		"system.slice/hugetlb.2MB.rsvd.max":  &fstest.MapFile{Data: []byte("max\n")},
+		"system.slice/memory.current":        &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/cgroup.freeze":         &fstest.MapFile{Data: []byte("0\n")},
+	}
+	c := New(mapfs, "", WithFiles("memory.current"), WithFileCollectors(
+		FileCollector{File: "memory.peak", Format: "single", Metric: "cgroup_memory_peak_bytes"},
+		FileCollector{File: "cpu.max.burst", Format: "single", Max: "inf", Metric: "cgroup_cpu_max_burst_seconds"},
+		FileCollector{File: "cpuset.cpus.effective", Format: "range-list", Metric: "cgroup_cpuset_cpus_effective"},
+		FileCollector{File: "cpu.stat.local", Format: "flat-keyed", Type: "counter", Scale: 1e-6, Metrics: map[string]string{"throttled_usec": "cgroup_cpu_local_throttled_seconds_total"}},
+		FileCollector{File: "rdma.current", Format: "nested-keyed", Label: "rdma_device", Metrics: map[string]string{"hca_object": "cgroup_rdma_hca_objects"}},
+		FileCollector{File: "hugetlb.*.current", Format: "single", Metric: "cgroup_hugetlb_current_bytes"},
+		FileCollector{File: "hugetlb.*.rsvd.max", Format: "single", Metric: "cgroup_hugetlb_rsvd_max_bytes"},
+	)).(*cgroupCollector)
+	c.errorHandler = func(err error) {
+		t.Error(err)
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	type sample struct {
+		name   string
+		labels string
+	}
+	values := make(map[sample]float64)
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		var labels string
+		for _, l := range dto.Label {
+			if *l.Name != "cgroup" {
+				labels += *l.Name + "=" + *l.Value
+			}
+		}
+		key := sample{c.metricNames[metric.Desc()], labels}
+		switch {
+		case dto.Counter != nil:
+			values[key] = *dto.Counter.Value
+		case dto.Gauge != nil:
+			values[key] = *dto.Gauge.Value
+		}
+	}
+	expected := map[sample]float64{
+		{"cgroup_memory_current_bytes", ""}:                          1,
+		{"cgroup_memory_peak_bytes", ""}:                             4096,
+		{"cgroup_cpu_max_burst_seconds", ""}:                         math.Inf(1),
+		{"cgroup_cpuset_cpus_effective", ""}:                         5,
+		{"cgroup_cpu_local_throttled_seconds_total", ""}:             1.5,
+		{"cgroup_rdma_hca_objects", "rdma_device=mlx4_0"}:            2000,
+		{"cgroup_hugetlb_current_bytes", "file=hugetlb.2MB.current"}: 2097152,
+		{"cgroup_hugetlb_current_bytes", "file=hugetlb.1GB.current"}: 0,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+	for key, value := range expected {
+		if v, ok := values[key]; !ok || v != value {
+			t.Errorf("%v: expected %f got %f", key, value, v)
+		}
+	}
+}
+
+func TestRangeListLen(t *testing.T) {
+	tests := map[string]int{"": 0, "0": 1, "0-3": 4, "0-3,8,10-11": 7}
+	for s, expected := range tests {
+		if n, err := rangeListLen(s); err != nil || n != expected {
+			t.Errorf("%q: expected %d got %d, %v", s, expected, n, err)
+		}
+	}
+	for _, s := range []string{"a", "3-1", "0-"} {
+		if _, err := rangeListLen(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestLoadConfigRejectsInvalidFileCollectors(t *testing.T) {
+	tests := map[string]string{
+		"supported file":   `{"files": [{"file": "memory.current", "format": "single", "metric": "a"}]}`,
+		"unknown format":   `{"files": [{"file": "a.b", "format": "csv", "metric": "a"}]}`,
+		"missing metrics":  `{"files": [{"file": "a.b", "format": "flat-keyed"}]}`,
+		"invalid metric":   `{"files": [{"file": "a.b", "format": "single", "metric": "a-b"}]}`,
+		"exported metric":  `{"files": [{"file": "a.b", "format": "single", "metric": "cgroup_memory_current_bytes"}]}`,
+		"duplicate metric": `{"files": [{"file": "a.b", "format": "single", "metric": "a"}, {"file": "a.c", "format": "single", "metric": "a"}]}`,
+		"invalid max":      `{"files": [{"file": "a.b", "format": "single", "metric": "a", "max": "lots"}]}`,
+		"reserved label":   `{"files": [{"file": "a.b", "format": "nested-keyed", "label": "cgroup", "metrics": {"a": "a"}}]}`,
+		"rule label":       `{"label_rules": [{"match": "(.*)", "labels": {"key": "$1"}}], "files": [{"file": "a.b", "format": "nested-keyed", "metrics": {"a": "a"}}]}`,
+	}
+	for name, config := range tests {
+		if _, err := LoadConfig(writeConfig(t, config)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestFileCollectorLabelSetByLabelRule(t *testing.T) {
+	rule, err := NewRegexp(`(.*)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(fstest.MapFS{}, "",
+		WithLabelRules([]LabelRule{{Match: rule, Labels: map[string]string{"key": "$1"}}}),
+		WithFileCollectors(FileCollector{File: "rdma.current", Format: "nested-keyed", Metrics: map[string]string{"hca_handle": "cgroup_rdma_hca_handles"}}),
+	).(*cgroupCollector)
+	if _, ok := c.multipleCollectors["rdma.current"]; ok {
+		t.Error("expected the file collector setting the label of a rule to be skipped")
+	}
+	if err := prometheus.NewPedanticRegistry().Register(c); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deadline stops a scrape when its context is done, so the scrape returns
+// what it collected until then.
+type deadline struct {
+	ctx       context.Context
+	truncated atomic.Bool
+}
+
+// expired reports whether the scrape has to stop, and records that it was
+// truncated if so.
+func (d *deadline) expired() bool {
+	if d == nil || d.ctx.Err() == nil {
+		return false
+	}
+	d.truncated.Store(true)
+	return true
+}
+
+// wasTruncated reports whether the scrape was stopped before it was done.
+func (d *deadline) wasTruncated() bool {
+	return d != nil && d.truncated.Load()
+}
+
+// Context returns a view of c, which must have been returned by New or
+// Filter, that stops collecting when ctx is done and exports the metrics it
+// collected until then. Context is meant to be called per scrape, e.g. with
+// the scrape timeout of an HTTP request. Truncated scrapes are flagged by
+// cgroup_exporter_scrape_truncated, if self metrics are enabled.
+func Context(ctx context.Context, c prometheus.Collector) (prometheus.Collector, error) {
+	base, ok := c.(*cgroupCollector)
+	if !ok {
+		return nil, fmt.Errorf("not a cgroup collector: %T", c)
+	}
+	view := *base
+	view.deadline = &deadline{ctx: ctx}
+	return &view, nil
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// cancelingfs cancels a scrape when the file name is opened.
+type cancelingfs struct {
+	fs.FS
+	name   string
+	cancel context.CancelFunc
+}
+
+func (c cancelingfs) Open(name string) (fs.File, error) {
+	if name == c.name {
+		c.cancel()
+	}
+	return c.FS.Open(name)
+}
+
+// collectTruncated returns the cgroups the view of c with ctx exported
+// metrics for, and the value of cgroup_exporter_scrape_truncated.
+func collectTruncated(t *testing.T, ctx context.Context, c prometheus.Collector) (map[string]bool, float64) {
+	t.Helper()
+	view, err := Context(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgroups := make(map[string]bool)
+	truncated := -1.0
+	for _, metric := range gather(view.Collect) {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		if metric.Desc() == c.(*cgroupCollector).stats.truncated {
+			truncated = *dto.Gauge.Value
+		}
+		for _, l := range dto.Label {
+			if *l.Name == "cgroup" {
+				cgroups[*l.Value] = true
+			}
+		}
+	}
+	return cgroups, truncated
+}
+
+func TestContextTruncatesScrape(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"a.slice/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+		"b.slice/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+		"c.slice/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(cancelingfs{FS: mapfs, name: "b.slice/memory.current", cancel: cancel}, "", WithSelfMetrics())
+
+	cgroups, truncated := collectTruncated(t, ctx, c)
+	if !cgroups["a.slice"] || !cgroups["b.slice"] || cgroups["c.slice"] {
+		t.Errorf("expected the cgroups collected before the deadline got %v", cgroups)
+	}
+	if truncated != 1 {
+		t.Errorf("expected the scrape to be truncated got %f", truncated)
+	}
+
+	// ctx is done already
+	cgroups, truncated = collectTruncated(t, ctx, c)
+	if len(cgroups) != 0 || truncated != 1 {
+		t.Errorf("expected no cgroups and a truncated scrape got %v, %f", cgroups, truncated)
+	}
+
+	cgroups, truncated = collectTruncated(t, context.Background(), New(mapfs, "", WithSelfMetrics()))
+	if len(cgroups) != 3 || truncated != 0 {
+		t.Errorf("expected all cgroups and no truncation got %v, %f", cgroups, truncated)
+	}
+}
+
+func TestContextKeepsStateOfUnscrapedCgroups(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"user.slice/session-1.scope/cpu.stat": &fstest.MapFile{Data: []byte("usage_usec 1000000\n")},
+		"user.slice/session-2.scope/cpu.stat": &fstest.MapFile{Data: []byte("usage_usec 2000000\n")},
+	}
+	c := New(mapfs, "", WithRollups("user.slice/session-*.scope")).(*cgroupCollector)
+	gather(c.Collect)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	view, err := Context(ctx, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gather(view.Collect)
+
+	values := collectValues(c)
+	if v := values[[2]string{"cgroup_cpu_usage_seconds_total", "user.slice/session-*.scope"}]; v != 3 {
+		t.Errorf("expected the rolled up counter to stay at 3 got %f", v)
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+)
+
+// deviceResolver maps the MAJ:MIN device numbers in io.stat to the names and
+// properties of the block devices in sysfs.
+type deviceResolver struct {
+	sysfs fs.FS
+	// report reports the errors reading the properties of devices.
+	report func(file string, err error)
+
+	mu     sync.Mutex
+	scrape uint64
+	cache  map[string]*deviceEntry
+}
+
+// deviceEntry is a device as resolved during a scrape.
+type deviceEntry struct {
+	// id identifies the device behind the device number, which is reused
+	// for other devices once it is removed.
+	id     string
+	labels []string
+	scrape uint64
+}
+
+// deviceLabels are the label names of the values returned by
+// deviceResolver.labels.
+var deviceLabels = []string{"device_name", "rotational", "model"}
+
+func newDeviceResolver(sysfs fs.FS, report func(file string, err error)) *deviceResolver {
+	return &deviceResolver{sysfs: sysfs, report: report, cache: make(map[string]*deviceEntry)}
+}
+
+// newScrape forgets the devices that were not looked up since the last
+// scrape, and has the others checked again on their next lookup.
+func (r *deviceResolver) newScrape() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for device, e := range r.cache {
+		if e.scrape != r.scrape {
+			delete(r.cache, device)
+		}
+	}
+	r.scrape++
+}
+
+// labels returns the device_name, rotational and model of device. Values that
+// are not available are empty. Device numbers like those of NVMe and
+// device-mapper devices are reused after a device is removed, so once per
+// scrape the name and disk sequence number in the uevent of the device are
+// checked, and the properties are read again if they changed.
+func (r *deviceResolver) labels(device string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.cache[device]
+	if ok && e.scrape == r.scrape {
+		return e.labels
+	}
+	dir := path.Join("dev/block", device)
+	uevent := r.uevent(dir)
+	id := uevent["DEVNAME"] + "/" + uevent["DISKSEQ"]
+	if !ok || e.id != id {
+		e = &deviceEntry{id: id, labels: make([]string, len(deviceLabels))}
+		if uevent["DEVNAME"] != "" {
+			e.labels = []string{
+				uevent["DEVNAME"],
+				r.readAttribute(path.Join(dir, "queue/rotational")),
+				r.readAttribute(path.Join(dir, "device/model")),
+			}
+		}
+		r.cache[device] = e
+	}
+	e.scrape = r.scrape
+	return e.labels
+}
+
+// uevent parses the KEY=VALUE lines of the uevent file in dir.
+func (r *deviceResolver) uevent(dir string) map[string]string {
+	f, err := r.sysfs.Open(path.Join(dir, "uevent"))
+	if err != nil {
+		slog.Debug("failed to open uevent", "device", dir, "error", err)
+		return nil
+	}
+	defer f.Close()
+	uevent := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), "="); ok {
+			uevent[k] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		r.report("uevent", fmt.Errorf("failed to read uevent of %s: %w", dir, err))
+	}
+	return uevent
+}
+
+// readAttribute returns the trimmed contents of a sysfs attribute, or an empty
+// string if it does not exist.
+func (r *deviceResolver) readAttribute(name string) string {
+	buf, err := fs.ReadFile(r.sysfs, name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// WithDeviceNames adds device_name, rotational and model labels to the io.stat
+// metrics by resolving their MAJ:MIN device numbers through
+// /sys/dev/block/<maj:min>. sysfs should be rooted at /sys.
+func WithDeviceNames(sysfs fs.FS) Option {
+	return func(c *cgroupCollector) {
+		c.devices = newDeviceResolver(sysfs, c.labelErrorReporter())
+	}
+}
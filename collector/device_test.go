@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+var sysfs = fstest.MapFS{
+	"dev/block/259:0/uevent":           &fstest.MapFile{Data: []byte("MAJOR=259\nMINOR=0\nDEVNAME=nvme0n1\nDEVTYPE=disk\nDISKSEQ=1\n")},
+	"dev/block/259:0/queue/rotational": &fstest.MapFile{Data: []byte("0\n")},
+	"dev/block/259:0/device/model":     &fstest.MapFile{Data: []byte("Samsung SSD 980 PRO 1TB                 \n")},
+	"dev/block/254:3/uevent":           &fstest.MapFile{Data: []byte("MAJOR=254\nMINOR=3\nDEVNAME=dm-3\nDEVTYPE=disk\n")},
+	"dev/block/254:3/queue/rotational": &fstest.MapFile{Data: []byte("0\n")},
+}
+
+func TestDeviceResolver(t *testing.T) {
+	r := newDeviceResolver(sysfs, func(file string, err error) { t.Error(err) })
+	tests := map[string][]string{
+		"259:0": {"nvme0n1", "0", "Samsung SSD 980 PRO 1TB"},
+		"254:3": {"dm-3", "0", ""},
+		"7:0":   {"", "", ""},
+	}
+	for device, expected := range tests {
+		if labels := r.labels(device); !slices.Equal(labels, expected) {
+			t.Errorf("%s: expected %q got %q", device, expected, labels)
+		}
+	}
+}
+
+func TestDeviceResolverRevalidates(t *testing.T) {
+	sysfs := fstest.MapFS{
+		"dev/block/259:1/uevent":       &fstest.MapFile{Data: []byte("DEVNAME=nvme1n1\nDISKSEQ=2\n")},
+		"dev/block/259:1/device/model": &fstest.MapFile{Data: []byte("Old disk\n")},
+	}
+	r := newDeviceResolver(sysfs, func(file string, err error) { t.Error(err) })
+	if labels := r.labels("7:0"); labels[0] != "" {
+		t.Errorf("expected no labels for a missing device got %q", labels)
+	}
+	sysfs["dev/block/7:0/uevent"] = &fstest.MapFile{Data: []byte("DEVNAME=loop0\n")}
+	r.newScrape()
+	if labels := r.labels("7:0"); labels[0] != "loop0" {
+		t.Errorf("expected the device appearing later to be resolved got %q", labels)
+	}
+
+	if labels := r.labels("259:1"); labels[2] != "Old disk" {
+		t.Errorf("expected Old disk got %q", labels)
+	}
+	// the disk is unplugged and its number reused by another one
+	sysfs["dev/block/259:1/uevent"] = &fstest.MapFile{Data: []byte("DEVNAME=nvme1n1\nDISKSEQ=3\n")}
+	sysfs["dev/block/259:1/device/model"] = &fstest.MapFile{Data: []byte("New disk\n")}
+	if labels := r.labels("259:1"); labels[2] != "Old disk" {
+		t.Errorf("expected the device to be checked once per scrape got %q", labels)
+	}
+	r.newScrape()
+	if labels := r.labels("259:1"); labels[2] != "New disk" {
+		t.Errorf("expected the new disk got %q", labels)
+	}
+
+	r.newScrape()
+	r.newScrape()
+	if len(r.cache) != 0 {
+		t.Errorf("expected the devices not looked up to be forgotten got %d", len(r.cache))
+	}
+}
+
+func TestIOStatDeviceLabels(t *testing.T) {
+	iostat := "259:0 rbytes=4249748992 wbytes=37844833792 rios=77099 wios=2067962 dbytes=1620828160 dios=9\n"
+	c := New(fstest.MapFS{}, "", WithDeviceNames(sysfs)).(*cgroupCollector)
+	ms := make(chan prometheus.Metric)
+	go func() {
+		defer close(ms)
+		if err := c.multipleCollectors["io.stat"].collect([]byte(iostat), []string{"system.slice"}, c.multipleCollectors["io.stat"].descs, ms); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for m := range ms {
+		dto := new(io_prometheus_client.Metric)
+		m.Write(dto)
+		labels := make(map[string]string)
+		for _, l := range dto.Label {
+			labels[*l.Name] = *l.Value
+		}
+		if labels["device"] != "259:0" || labels["device_name"] != "nvme0n1" || labels["rotational"] != "0" || labels["model"] != "Samsung SSD 980 PRO 1TB" || labels["cgroup"] != "system.slice" {
+			t.Errorf("unexpected labels %v", labels)
+		}
+	}
+}
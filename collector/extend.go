@@ -0,0 +1,197 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric declares a metric collected from a file by an extension.
+type Metric struct {
+	Name string
+	Help string
+	// Labels are the names of the variable labels the collect function sets,
+	// before the labels of the cgroup.
+	Labels []string
+}
+
+// CollectKeyedFunc collects the metrics of a file with multiple metrics, keyed
+// like the metrics passed to WithKeyedFileCollector. labels are the label
+// values of the cgroup, like for a CollectFunc.
+type CollectKeyedFunc func(f io.Reader, labels []string, descs map[string]*prometheus.Desc, m chan<- prometheus.Metric) error
+
+// extension is a file collected by code outside of this package.
+type extension struct {
+	file         string
+	metric       Metric
+	metrics      map[string]Metric
+	collect      CollectFunc
+	collectKeyed CollectKeyedFunc
+}
+
+// addExtension adds the collector of e to the tables of c and of its
+// profiles, as extension files are always collected.
+func (c *cgroupCollector) addExtension(e extension, newDesc func(name, help string, variableLabels ...string) *prometheus.Desc) error {
+	if e.file == "" || strings.ContainsAny(e.file, `/*?[\`) {
+		return fmt.Errorf("invalid file %q", e.file)
+	}
+	if slices.Contains(supportedFiles, e.file) {
+		return fmt.Errorf("file %q is supported already", e.file)
+	}
+	if _, ok := c.singleCollectors[e.file]; ok {
+		return fmt.Errorf("file %q is collected already", e.file)
+	}
+	if _, ok := c.multipleCollectors[e.file]; ok {
+		return fmt.Errorf("file %q is collected already", e.file)
+	}
+	metrics := e.metrics
+	if e.collect != nil {
+		metrics = map[string]Metric{"": e.metric}
+	}
+	if len(metrics) == 0 {
+		return fmt.Errorf("no metrics for %q", e.file)
+	}
+	for _, metric := range metrics {
+		if err := c.validateMetric(metric); err != nil {
+			return err
+		}
+	}
+
+	if e.collect != nil {
+		collect := e.collect
+		c.addCollector(e.file, collector{desc: newDesc(e.metric.Name, e.metric.Help, e.metric.Labels...), collect: func(b []byte, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+			return collect(bytes.NewReader(b), labels, desc, m)
+		}}, multipleCollector{})
+		return nil
+	}
+	multiple := multipleCollector{descs: make(map[string]desc)}
+	descs := make(map[string]*prometheus.Desc)
+	for key, metric := range metrics {
+		d := newDesc(metric.Name, metric.Help, metric.Labels...)
+		multiple.descs[key] = desc{desc: d}
+		descs[key] = d
+	}
+	collect := e.collectKeyed
+	multiple.collect = func(b []byte, labels []string, _ map[string]desc, m chan<- prometheus.Metric) error {
+		return collect(bytes.NewReader(b), labels, descs, m)
+	}
+	c.addCollector(e.file, collector{}, multiple)
+	return nil
+}
+
+// validateMetric returns an error if metric can't be added to the metrics of
+// c.
+func (c *cgroupCollector) validateMetric(metric Metric) error {
+	if !metricName.MatchString(metric.Name) {
+		return fmt.Errorf("invalid metric name %q", metric.Name)
+	}
+	for _, name := range c.metricNames {
+		if name == metric.Name {
+			return fmt.Errorf("metric %q is exported already", metric.Name)
+		}
+	}
+	for i, label := range metric.Labels {
+		if !labelName.MatchString(label) {
+			return fmt.Errorf("invalid label name %q", label)
+		}
+		if c.setsLabel(label) {
+			return fmt.Errorf("label %q is set by the collector", label)
+		}
+		if slices.Contains(metric.Labels[:i], label) {
+			return fmt.Errorf("label %q is repeated", label)
+		}
+	}
+	return nil
+}
+
+// CollectFlatKeyed collects a flat-keyed file, like memory.events, with one
+// metric per key. Unknown keys and values of max are skipped.
+func CollectFlatKeyed(valueType prometheus.ValueType) CollectKeyedFunc {
+	return func(f io.Reader, labels []string, descs map[string]*prometheus.Desc, m chan<- prometheus.Metric) error {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return collectFlatKeyed(b, valueType, parseValue, func(key string) *prometheus.Desc { return descs[key] }, labels, m)
+	}
+}
+
+// CollectNestedKeyed collects a nested-keyed file, like io.stat, with one
+// metric per sub-key. The key of each line is the value of the first variable
+// label of the metrics. Unknown sub-keys and values of max are skipped.
+func CollectNestedKeyed(valueType prometheus.ValueType) CollectKeyedFunc {
+	return func(f io.Reader, labels []string, descs map[string]*prometheus.Desc, m chan<- prometheus.Metric) error {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		return collectNestedKeyedFile(b, valueType, parseValue, func(key string) *prometheus.Desc { return descs[key] }, labels, m)
+	}
+}
+
+// WithFileCollector collects the metric from file with collect, e.g.
+// CollectSingleValue, so files the exporter doesn't support can be collected
+// without changing it. file is always collected. Invalid collectors, like ones
+// for supported files or metrics, are logged and skipped.
+func WithFileCollector(file string, metric Metric, collect CollectFunc) Option {
+	return func(c *cgroupCollector) {
+		c.extensions = append(c.extensions, extension{file: file, metric: metric, collect: collect})
+	}
+}
+
+// WithKeyedFileCollector is like WithFileCollector for files with multiple
+// metrics, e.g. collected with CollectFlatKeyed or CollectNestedKeyed.
+func WithKeyedFileCollector(file string, metrics map[string]Metric, collect CollectKeyedFunc) Option {
+	return func(c *cgroupCollector) {
+		c.extensions = append(c.extensions, extension{file: file, metrics: metrics, collectKeyed: collect})
+	}
+}
+
+// WithGlob only collects the cgroups matching the pattern glob, like the glob
+// passed to New, which takes precedence.
+func WithGlob(glob string) Option {
+	return func(c *cgroupCollector) {
+		c.glob = glob
+	}
+}
+
+// WithLabelFunc adds the labels names to every metric, with the values
+// returned by values for the path of the cgroup, relative to the root of the
+// hierarchy. values must return one value per name; an empty value means the
+// label does not apply to the cgroup. Invalid or reserved names, and names
+// set by other options, are logged and the labels skipped.
+func WithLabelFunc(names []string, values func(cgroup string) []string) Option {
+	return func(c *cgroupCollector) {
+		for _, name := range names {
+			if slices.Contains(reservedLabels, name) {
+				slog.Error("reserved label name, not adding labels", "label", name)
+				return
+			}
+		}
+		names := slices.Clone(names)
+		c.labelers = append(c.labelers, labeler{
+			names: names,
+			values: func(cgroup string) []string {
+				v := values(cgroup)
+				if len(v) != len(names) {
+					c.errorHandler(fmt.Errorf("label function returned %d values for %d labels of cgroup %s", len(v), len(names), cgroup))
+					return make([]string, len(names))
+				}
+				return v
+			},
+		})
+	}
+}
+
+// WithErrorHandler passes the errors collecting cgroups to handle instead of
+// logging them. handle may be called concurrently.
+func WithErrorHandler(handle func(error)) Option {
+	return func(c *cgroupCollector) {
+		c.errorHandler = handle
+	}
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestExtensions(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.peak":             &fstest.MapFile{Data: []byte("4096\n")},
+		"system.slice/cpu.stat.local":          &fstest.MapFile{Data: []byte("throttled_usec 15\nunknown 1\n")},
+		"system.slice/rdma.current":            &fstest.MapFile{Data: []byte("mlx4_0 hca_handle=2 hca_object=2000\nmlx4_1 hca_handle=2 hca_object=max\n")},
+		"system.slice/nginx.service/broken.me": &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/nginx.service/other.me":  &fstest.MapFile{Data: []byte("1\n")},
+	}
+	var errs []error
+	c := New(mapfs, "",
+		WithFiles("memory.current"),
+		WithGlob("system.slice/**"),
+		WithErrorHandler(func(err error) { errs = append(errs, err) }),
+		WithLabelFunc([]string{"team"}, func(cgroup string) []string {
+			if strings.HasSuffix(cgroup, ".service") {
+				return []string{"web"}
+			}
+			return []string{""}
+		}),
+		WithFileCollector("memory.peak", Metric{Name: "cgroup_memory_peak_bytes"}, CollectSingleValue(prometheus.GaugeValue)),
+		WithKeyedFileCollector("cpu.stat.local", map[string]Metric{
+			"throttled_usec": {Name: "cgroup_cpu_local_throttled_usec_total"},
+		}, CollectFlatKeyed(prometheus.CounterValue)),
+		WithKeyedFileCollector("rdma.current", map[string]Metric{
+			"hca_object": {Name: "cgroup_rdma_hca_objects", Labels: []string{"rdma_device"}},
+		}, CollectNestedKeyed(prometheus.GaugeValue)),
+		WithFileCollector("broken.me", Metric{Name: "cgroup_broken"}, func(f io.Reader, labels []string, desc *prometheus.Desc, m chan<- prometheus.Metric) error {
+			return errors.New("broken")
+		}),
+		// invalid, as memory.current is supported already
+		WithFileCollector("memory.current", Metric{Name: "cgroup_memory_current"}, CollectSingleValue(prometheus.GaugeValue)),
+	).(*cgroupCollector)
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	got := make(map[string]string)
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		name := c.metricNames[metric.Desc()]
+		if name == "cgroup_info" {
+			continue
+		}
+		var labels []string
+		for _, l := range dto.Label {
+			labels = append(labels, *l.Name+"="+*l.Value)
+		}
+		got[name] = strings.Join(labels, ",")
+	}
+	expected := map[string]string{
+		"cgroup_memory_peak_bytes":              "cgroup=system.slice,team=",
+		"cgroup_cpu_local_throttled_usec_total": "cgroup=system.slice,team=",
+		"cgroup_rdma_hca_objects":               "cgroup=system.slice,rdma_device=mlx4_0,team=",
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %v got %v", expected, got)
+	}
+	for name, labels := range expected {
+		if got[name] != labels {
+			t.Errorf("%s: expected %s got %s", name, labels, got[name])
+		}
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "broken") {
+		t.Errorf("expected the error of broken.me got %v", errs)
+	}
+
+	if _, err := Filter(c, nil, []string{"cpu.stat.local"}); err != nil {
+		t.Errorf("expected extension file to be collectable got %v", err)
+	}
+}
+
+func TestLabelFuncReturningTooFewValues(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	var errs int
+	c := New(mapfs, "",
+		WithErrorHandler(func(err error) { errs++ }),
+		WithLabelFunc([]string{"a", "b"}, func(cgroup string) []string { return nil }),
+	)
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	n := 0
+	for range metrics {
+		n++
+	}
+	if n == 0 || errs == 0 {
+		t.Errorf("expected metrics with empty labels and errors got %d metrics and %d errors", n, errs)
+	}
+}
+
+func TestDuplicateLabelsAreSkipped(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	rule, err := NewRegexp(`(.*)\.slice`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(mapfs, "",
+		WithLabelFunc([]string{"team"}, func(cgroup string) []string { return []string{"web"} }),
+		WithLabelRules([]LabelRule{{Match: rule, Labels: map[string]string{"team": "$1"}}}),
+		WithLabelFunc([]string{"owner", "owner"}, func(cgroup string) []string { return []string{"a", "a"} }),
+	).(*cgroupCollector)
+	if len(c.labelers) != 1 {
+		t.Errorf("expected the labelers setting labels again to be skipped got %d labelers", len(c.labelers))
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Error(err)
+	}
+}
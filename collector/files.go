@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// supportedFiles, supportedControllers and supportedMetrics are the sorted
+// names of the files the collector supports, of their controllers and of the
+// metric families exported for them. They are computed once, as configurations
+// and filters are validated against them.
+var supportedFiles, supportedControllers, supportedMetrics []string
+
+func init() {
+	c := New(nil, "").(*cgroupCollector)
+	for name := range c.singleCollectors {
+		supportedFiles = append(supportedFiles, name)
+	}
+	for name := range c.multipleCollectors {
+		supportedFiles = append(supportedFiles, name)
+	}
+	slices.Sort(supportedFiles)
+	for _, file := range supportedFiles {
+		if c := controller(file); !slices.Contains(supportedControllers, c) {
+			supportedControllers = append(supportedControllers, c)
+		}
+	}
+	slices.Sort(supportedControllers)
+	for _, d := range tableDescs(c.singleCollectors, c.multipleCollectors) {
+		supportedMetrics = append(supportedMetrics, c.metricNames[d])
+	}
+	slices.Sort(supportedMetrics)
+	supportedMetrics = slices.Compact(supportedMetrics)
+}
+
+// Files returns the sorted names of the cgroup files the collector supports.
+func Files() []string {
+	return slices.Clone(supportedFiles)
+}
+
+// Controllers returns the sorted names of the controllers of the files the
+// collector supports.
+func Controllers() []string {
+	return slices.Clone(supportedControllers)
+}
+
+// controller returns the controller a cgroup file belongs to, e.g. memory for
+// memory.stat.
+func controller(file string) string {
+	c, _, _ := strings.Cut(file, ".")
+	return c
+}
+
+// presets are named sets of files to collect. full collects every file.
+var presets = map[string][]string{
+	"minimal": {
+		"cpu.stat", "cpu.pressure",
+		"memory.current", "memory.max", "memory.pressure",
+		"io.pressure",
+		"pids.current",
+	},
+	"standard": {
+		"cpu.stat", "cpu.pressure",
+		"memory.current", "memory.min", "memory.low", "memory.high", "memory.max", "memory.events", "memory.pressure",
+		"memory.swap.current", "memory.swap.max",
+		"io.stat", "io.pressure",
+		"pids.current", "pids.max", "pids.events",
+	},
+}
+
+// Selection selects the files to collect. It starts from the files of
+// Preset and then applies Enable and Disable. Their entries are either file
+// names, like memory.stat, or controller names, like memory, which select all
+// files of the controller. File names take precedence over controller names,
+// and Disable takes precedence over Enable.
+type Selection struct {
+	// Preset is minimal, standard or full. The default is full.
+	Preset  string   `json:"preset"`
+	Enable  []string `json:"enable"`
+	Disable []string `json:"disable"`
+}
+
+func (s Selection) isZero() bool {
+	return s.Preset == "" && len(s.Enable) == 0 && len(s.Disable) == 0
+}
+
+// Override returns s with the choices made by o taking precedence, e.g. to
+// let command line flags override the configuration file.
+func (s Selection) Override(o Selection) Selection {
+	if o.Preset != "" {
+		s.Preset = o.Preset
+	}
+	s.Enable = slices.DeleteFunc(slices.Clone(s.Enable), func(name string) bool { return slices.Contains(o.Disable, name) })
+	s.Disable = slices.DeleteFunc(slices.Clone(s.Disable), func(name string) bool { return slices.Contains(o.Enable, name) })
+	s.Enable = append(s.Enable, o.Enable...)
+	s.Disable = append(s.Disable, o.Disable...)
+	return s
+}
+
+// Files returns the selected files.
+func (s Selection) Files() ([]string, error) {
+	all := supportedFiles
+	enabled := make(map[string]bool)
+	switch s.Preset {
+	case "", "full":
+		for _, file := range all {
+			enabled[file] = true
+		}
+	default:
+		files, ok := presets[s.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q", s.Preset)
+		}
+		for _, file := range files {
+			enabled[file] = true
+		}
+	}
+
+	controllers := supportedControllers
+	for _, name := range s.Enable {
+		if !slices.Contains(all, name) && !slices.Contains(controllers, name) {
+			return nil, fmt.Errorf("unknown file or controller %q", name)
+		}
+	}
+	for _, name := range s.Disable {
+		if !slices.Contains(all, name) && !slices.Contains(controllers, name) {
+			slog.Warn("disabling unsupported file or controller", "name", name)
+		}
+	}
+
+	for _, file := range all {
+		switch {
+		case slices.Contains(s.Disable, file):
+			enabled[file] = false
+		case slices.Contains(s.Enable, file):
+			enabled[file] = true
+		case slices.Contains(s.Disable, controller(file)):
+			enabled[file] = false
+		case slices.Contains(s.Enable, controller(file)):
+			enabled[file] = true
+		}
+	}
+
+	var files []string
+	for _, file := range all {
+		if enabled[file] {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// WithFiles restricts collection to the named cgroup files. Other files are
+// neither described nor opened.
+func WithFiles(files ...string) Option {
+	return func(c *cgroupCollector) {
+		c.files = make(map[string]bool)
+		for _, file := range files {
+			c.files[file] = true
+		}
+	}
+}
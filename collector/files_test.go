@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"io/fs"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection Selection
+		contains  []string
+		excludes  []string
+	}{
+		{"full", Selection{}, Files(), nil},
+		{"minimal", Selection{Preset: "minimal"}, []string{"cpu.stat", "memory.current"}, []string{"memory.stat", "io.stat"}},
+		{"disable file", Selection{Disable: []string{"memory.stat", "memory.numa_stat"}}, []string{"memory.current", "io.stat"}, []string{"memory.stat"}},
+		{"disable controller", Selection{Disable: []string{"io"}}, []string{"memory.stat"}, []string{"io.stat", "io.pressure"}},
+		{"file beats controller", Selection{Enable: []string{"memory.stat"}, Disable: []string{"memory"}}, []string{"memory.stat"}, []string{"memory.current"}},
+		{"enable on top of preset", Selection{Preset: "minimal", Enable: []string{"memory.stat"}}, []string{"memory.stat", "cpu.stat"}, []string{"io.stat"}},
+	}
+	for _, tt := range tests {
+		files, err := tt.selection.Files()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, file := range tt.contains {
+			if !slices.Contains(files, file) {
+				t.Errorf("%s: expected %s to be selected", tt.name, file)
+			}
+		}
+		for _, file := range tt.excludes {
+			if slices.Contains(files, file) {
+				t.Errorf("%s: expected %s not to be selected", tt.name, file)
+			}
+		}
+	}
+
+	if _, err := (Selection{Preset: "tiny"}).Files(); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+	if _, err := (Selection{Enable: []string{"memory.numa_stat"}}).Files(); err == nil {
+		t.Error("expected error for enabling unknown file")
+	}
+}
+
+type forbidfs struct {
+	t *testing.T
+	fs.FS
+	forbidden string
+}
+
+func (f *forbidfs) Open(name string) (fs.File, error) {
+	if name == f.forbidden {
+		f.t.Errorf("should not open %s", name)
+	}
+	return f.FS.Open(name)
+}
+
+func TestSelectionOverride(t *testing.T) {
+	config := Selection{Preset: "standard", Enable: []string{"memory.stat"}, Disable: []string{"io.stat"}}
+	flags := Selection{Enable: []string{"io.stat"}, Disable: []string{"memory.stat"}}
+	files, err := config.Override(flags).Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(files, "io.stat") || slices.Contains(files, "memory.stat") {
+		t.Errorf("expected flags to take precedence got %v", files)
+	}
+}
+
+func TestWithFilesDoesntOpenDisabledFiles(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.pressure": &fstest.MapFile{Data: []byte("some avg10=0.08 avg60=0.03 avg300=0.06 total=7113021\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n")},
+		"system.slice/memory.current":  &fstest.MapFile{Data: []byte("1\n")},
+	}
+	c := New(&forbidfs{t: t, FS: mapfs, forbidden: "system.slice/memory.pressure"}, "", WithFiles("memory.current"))
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	n := 0
+	for range metrics {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("expected 1 metric got %d", n)
+	}
+}
+
+func TestFilesAreCopied(t *testing.T) {
+	files := Files()
+	files[0] = "changed"
+	if Files()[0] == "changed" {
+		t.Error("expected Files to return a copy")
+	}
+}
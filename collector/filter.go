@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxFilterPatterns and maxFilterPatternLen bound the patterns a view can be
+// filtered with, as they usually come from URL parameters.
+const (
+	maxFilterPatterns   = 16
+	maxFilterPatternLen = 256
+)
+
+// Filter returns a view of c, which must have been returned by New, that only
+// collects the cgroups matching any of patterns and their descendants, and
+// only the files or controllers in collect. Empty lists don't filter. The
+// filter narrows down what c is configured to collect, and the view shares
+// the state of c, like the invocation IDs seen. Filter is meant to be called
+// per scrape, e.g. with the parameters of an HTTP request, so it accepts at
+// most 16 patterns of at most 256 bytes.
+func Filter(c prometheus.Collector, patterns, collect []string) (prometheus.Collector, error) {
+	base, ok := c.(*cgroupCollector)
+	if !ok {
+		return nil, fmt.Errorf("not a cgroup collector: %T", c)
+	}
+	view := *base
+	view.filtered = true
+	if len(patterns) > maxFilterPatterns {
+		return nil, fmt.Errorf("too many patterns: %d, at most %d", len(patterns), maxFilterPatterns)
+	}
+	if len(patterns) > 0 {
+		view.filterIncludes = make([]pattern, 0, len(patterns))
+		for _, p := range patterns {
+			if len(p) > maxFilterPatternLen {
+				return nil, fmt.Errorf("pattern too long: %d bytes, at most %d", len(p), maxFilterPatternLen)
+			}
+			compiled, err := compilePattern(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+			view.filterIncludes = append(view.filterIncludes, compiled)
+		}
+	}
+	if len(collect) > 0 {
+		files, controllers := supportedFiles, supportedControllers
+		view.collect = make(map[string]bool)
+		for _, name := range collect {
+			if base.declared(name) {
+				view.collect[name] = true
+				continue
+			}
+			if !slices.Contains(files, name) && !slices.Contains(controllers, name) {
+				return nil, fmt.Errorf("unknown file or controller %q", name)
+			}
+			for _, file := range files {
+				if file == name || controller(file) == name {
+					view.collect[file] = true
+				}
+			}
+		}
+	}
+	return &view, nil
+}
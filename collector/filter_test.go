@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestFilter(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"machine.slice/memory.current":                       &fstest.MapFile{Data: []byte("1\n")},
+		"machine.slice/machine-web.scope/memory.current":     &fstest.MapFile{Data: []byte("1\n")},
+		"machine.slice/machine-web.scope/cpu.stat":           &fstest.MapFile{Data: []byte("usage_usec 1\n")},
+		"machine.slice/machine-web.scope/sub/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/memory.current":                        &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/nginx.service/cpu.stat":                &fstest.MapFile{Data: []byte("usage_usec 1\n")},
+	}
+	c := New(mapfs, "", WithExclude("machine.slice/*/sub"))
+	filtered, err := Filter(c, []string{"machine.slice/**/*.scope"}, []string{"cpu", "memory.current"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		filtered.Collect(metrics)
+	}()
+	var got []string
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		for _, l := range dto.Label {
+			if *l.Name == "cgroup" {
+				got = append(got, *l.Value)
+			}
+		}
+	}
+	slices.Sort(got)
+	// the configured exclude still applies
+	expected := []string{"machine.slice/machine-web.scope", "machine.slice/machine-web.scope"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("expected %v got %v", expected, got)
+	}
+
+	if _, err := Filter(c, []string{"["}, nil); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	if _, err := Filter(c, strings.Split(strings.Repeat("system.slice,", 16)+"system.slice", ","), nil); err == nil {
+		t.Error("expected error for too many patterns")
+	}
+	if _, err := Filter(c, []string{strings.Repeat("**/", 100) + "nomatch"}, nil); err == nil {
+		t.Error("expected error for a too long pattern")
+	}
+	if _, err := Filter(c, nil, []string{"memory.numa_stat"}); err == nil || !strings.Contains(err.Error(), "memory.numa_stat") {
+		t.Errorf("expected error for unknown file got %v", err)
+	}
+
+	declared := New(mapfs, "", WithFileCollectors(FileCollector{File: "memory.peak", Format: "single", Metric: "cgroup_memory_peak_bytes"}))
+	if _, err := Filter(declared, nil, []string{"memory.peak"}); err != nil {
+		t.Errorf("expected declared file to be collectable got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/arianvp/cgroup-exporter/cgroupfs"
+)
+
+// dirFS is the file system of the directory dir, usually the cgroup
+// hierarchy. Besides the files, it reads their extended attributes and opens
+// directories to read the files of a cgroup relative to them.
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// DirFS returns a file system for the tree of files rooted at dir, like
+// os.DirFS, that also implements XattrFS.
+func DirFS(dir string) XattrFS {
+	return dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// OpenDir implements cgroupfs.DirFS.
+func (d dirFS) OpenDir(name string) (cgroupfs.Dir, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	return cgroupfs.OpenOSDir(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
@@ -0,0 +1,31 @@
+package collector
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// Getxattr implements XattrFS.
+func (d dirFS) Getxattr(name, attr string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: fs.ErrInvalid}
+	}
+	path := filepath.Join(d.dir, filepath.FromSlash(name))
+	buf := make([]byte, 64)
+	for {
+		n, err := syscall.Getxattr(path, attr, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			// the value grew since we sized the buffer, ask for its size again
+			if n, err = syscall.Getxattr(path, attr, nil); err == nil {
+				buf = make([]byte, n)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "getxattr", Path: name, Err: err}
+		}
+		return buf[:n], nil
+	}
+}
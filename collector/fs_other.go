@@ -0,0 +1,13 @@
+//go:build !linux
+
+package collector
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Getxattr implements XattrFS. Extended attributes are only read on Linux.
+func (d dirFS) Getxattr(name, attr string) ([]byte, error) {
+	return nil, &fs.PathError{Op: "getxattr", Path: name, Err: errors.ErrUnsupported}
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/arianvp/cgroup-exporter/cgroupfs"
+)
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "system.slice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "system.slice/memory.current"), []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := DirFS(dir)
+	if buf, err := fs.ReadFile(fsys, "system.slice/memory.current"); err != nil || string(buf) != "1\n" {
+		t.Errorf("expected 1 got %q, %v", buf, err)
+	}
+
+	d, err := fsys.(cgroupfs.DirFS).OpenDir("system.slice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if buf, err := d.ReadFile("memory.current", nil); err != nil || string(buf) != "1\n" {
+		t.Errorf("expected 1 got %q, %v", buf, err)
+	}
+
+	for _, name := range []string{"../etc", "/system.slice"} {
+		if _, err := fsys.(cgroupfs.DirFS).OpenDir(name); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if _, err := fsys.Getxattr(name, "user.invocation_id"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithIndex keeps the cgroup directories in memory, so scrapes only read the
+// files of the cgroups instead of walking the whole hierarchy. The index is
+// maintained with inotify and rebuilt every resync interval, if it is
+// positive, until ctx is done. The file system passed to New must be created by DirFS.
+// Indexing needs inotify, so it is only supported on Linux.
+func WithIndex(ctx context.Context, resync time.Duration) Option {
+	return func(c *cgroupCollector) {
+		d, ok := c.fs.(dirFS)
+		if !ok {
+			slog.Warn("cgroup file system is not a directory, not indexing cgroups")
+			return
+		}
+		i, err := newIndex(ctx, d, d.dir, resync)
+		if err != nil {
+			slog.Warn("failed to index cgroups", "error", err)
+			return
+		}
+		c.fs = i
+	}
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/arianvp/cgroup-exporter/cgroupfs"
+)
+
+// indexMask are the inotify events that change the entries of a directory.
+const indexMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// index is a file system that keeps the entries of the directories read from
+// it in memory, so walking the hierarchy doesn't list every cgroup directory
+// on every scrape. Directories are watched with inotify and dropped from the
+// index when their entries change. The whole index is dropped every resync
+// interval, in case an event was missed.
+type index struct {
+	XattrFS
+	dir string
+	fd  int
+
+	mu         sync.Mutex
+	closed     bool
+	entries    map[string][]fs.DirEntry
+	watches    map[int32]string
+	generation uint64
+}
+
+// newIndex indexes fsys, which is rooted at the directory dir, until ctx is
+// done.
+func newIndex(ctx context.Context, fsys XattrFS, dir string, resync time.Duration) (*index, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	i := &index{
+		XattrFS: fsys,
+		dir:     dir,
+		fd:      fd,
+		entries: make(map[string][]fs.DirEntry),
+		watches: make(map[int32]string),
+	}
+	f := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		i.close(f)
+	}()
+	go i.watch(f)
+	go i.resync(ctx, resync)
+	return i, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (i *index) ReadDir(name string) ([]fs.DirEntry, error) {
+	i.mu.Lock()
+	if entries, ok := i.entries[name]; ok {
+		i.mu.Unlock()
+		return slices.Clone(entries), nil
+	}
+	if i.closed {
+		i.mu.Unlock()
+		return fs.ReadDir(i.XattrFS, name)
+	}
+	// watch before reading, so changes made while reading are not missed
+	wd, err := syscall.InotifyAddWatch(i.fd, filepath.Join(i.dir, filepath.FromSlash(name)), indexMask)
+	if err != nil {
+		i.mu.Unlock()
+		slog.Debug("failed to watch cgroup, not indexing it", "cgroup", name, "error", err)
+		return fs.ReadDir(i.XattrFS, name)
+	}
+	i.watches[int32(wd)] = name
+	generation := i.generation
+	i.mu.Unlock()
+
+	entries, err := fs.ReadDir(i.XattrFS, name)
+	if err != nil {
+		return nil, err
+	}
+	i.mu.Lock()
+	if i.generation == generation && !i.closed {
+		i.entries[name] = slices.Clone(entries)
+	}
+	i.mu.Unlock()
+	return entries, nil
+}
+
+// OpenDir implements cgroupfs.DirFS, if the indexed file system does.
+func (i *index) OpenDir(name string) (cgroupfs.Dir, error) {
+	return cgroupfs.OpenDir(i.XattrFS, name)
+}
+
+// close stops indexing and closes the inotify file descriptor f.
+func (i *index) close(f *os.File) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.closed {
+		return
+	}
+	i.closed = true
+	clear(i.entries)
+	f.Close()
+}
+
+// invalidate drops the entries of the directory name, or of all directories
+// if name is empty.
+func (i *index) invalidate(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.generation++
+	if name == "" {
+		clear(i.entries)
+		return
+	}
+	delete(i.entries, name)
+}
+
+// watch drops the directories from the index whose entries changed, until f
+// is closed.
+func (i *index) watch(f *os.File) {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				slog.Error("failed to read inotify events, not indexing cgroups anymore", "error", err)
+				i.close(f)
+			}
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[offset:]))
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			length := binary.NativeEndian.Uint32(buf[offset+12:])
+			offset += syscall.SizeofInotifyEvent + int(length)
+
+			if mask&syscall.IN_Q_OVERFLOW != 0 {
+				i.invalidate("")
+				continue
+			}
+			i.mu.Lock()
+			name, ok := i.watches[wd]
+			if mask&syscall.IN_IGNORED != 0 {
+				delete(i.watches, wd)
+			}
+			i.mu.Unlock()
+			if ok {
+				i.invalidate(name)
+				if mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+					i.invalidate(path.Dir(name))
+				}
+			}
+		}
+	}
+}
+
+// resync drops the whole index every interval, until ctx is done.
+func (i *index) resync(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			i.invalidate("")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// readdirfs counts the directories read.
+type readdirfs struct {
+	XattrFS
+	reads int
+}
+
+func (r *readdirfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	r.reads++
+	return fs.ReadDir(r.XattrFS, name)
+}
+
+func TestIndex(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "system.slice/nginx.service"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	spy := &readdirfs{XattrFS: DirFS(dir)}
+	i, err := newIndex(ctx, spy, dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := func() []string {
+		entries, err := fs.ReadDir(i, "system.slice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	if n := names(); !slices.Equal(n, []string{"nginx.service"}) {
+		t.Errorf("unexpected entries %v", n)
+	}
+	names()
+	if spy.reads != 1 {
+		t.Errorf("expected 1 read got %d", spy.reads)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "system.slice/sshd.service"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if n := names(); slices.Equal(n, []string{"nginx.service", "sshd.service"}) {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected the new directory to be indexed got %v", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		reads := spy.reads
+		names()
+		if spy.reads > reads {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the index to be dropped when the context is done")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithIndexRequiresDirFS(t *testing.T) {
+	c := New(cgroup, "", WithIndex(context.Background(), time.Hour)).(*cgroupCollector)
+	if _, ok := c.fs.(*index); ok {
+		t.Error("expected embed.FS not to be indexed")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// index is not supported without inotify.
+type index struct {
+	XattrFS
+}
+
+func newIndex(ctx context.Context, fsys XattrFS, dir string, resync time.Duration) (*index, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package collector
+
+import "io/fs"
+
+// inode returns the inode number of the file of info, which only files on
+// Unix have.
+func inode(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
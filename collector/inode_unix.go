@@ -0,0 +1,17 @@
+//go:build unix
+
+package collector
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// inode returns the inode number of the file of info, if it has one.
+func inode(info fs.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Ino), true
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package collector
+
+import (
+	"io/fs"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestExportsCgroupInfo(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice":            &fstest.MapFile{Mode: fs.ModeDir, Sys: &syscall.Stat_t{Ino: 4242}},
+		"system.slice/memory.min": &fstest.MapFile{Data: []byte("1\n")},
+	}
+
+	c := New(mapfs, "")
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+
+	metric := <-metrics
+	if metric == nil {
+		t.Fatal("expected metric")
+	}
+	if !strings.Contains(metric.Desc().String(), `"cgroup_info"`) {
+		t.Fatalf("expected cgroup_info got %s", metric.Desc())
+	}
+	dto := new(io_prometheus_client.Metric)
+	metric.Write(dto)
+	expected := map[string]string{"cgroup": "system.slice", "cgroup_id": "4242", "path": "/system.slice"}
+	for _, l := range dto.Label {
+		if expected[*l.Name] != *l.Value {
+			t.Errorf("expected %s=%q got %q", *l.Name, expected[*l.Name], *l.Value)
+		}
+	}
+	for range metrics {
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// XattrFS is a file system that can read the extended attributes of its
+// files.
+type XattrFS interface {
+	fs.FS
+
+	// Getxattr returns the value of the extended attribute attr of the file
+	// name.
+	Getxattr(name, attr string) ([]byte, error)
+}
+
+// invocationAttrs are the extended attributes systemd tags the cgroup of a
+// unit with. Unlike the trusted one, the user one can be read without
+// CAP_SYS_ADMIN, but it is only set by systemd 247 and later.
+var invocationAttrs = []string{"user.invocation_id", "trusted.invocation_id"}
+
+// invocationTracker exports the systemd invocation ID of each cgroup and
+// counts how often it changed, i.e. how often the unit was restarted.
+type invocationTracker struct {
+	fs      XattrFS
+	info    *prometheus.Desc
+	changes *prometheus.Desc
+
+	mu          sync.Mutex
+	invocations map[string]*invocation
+}
+
+type invocation struct {
+	id      string
+	changes float64
+	// missed is the number of scrapes in a row that didn't find the cgroup.
+	missed int
+}
+
+// invocationGrace is the number of scrapes in a row the cgroup of a unit can
+// be missing before its invocation is forgotten. The cgroup is removed and
+// created again when the unit restarts, which a scrape may fall in between
+// of, and the changes of the unit would start over.
+const invocationGrace = 5
+
+// invocationID returns the invocation ID of the unit owning the cgroup at
+// path, or an empty string if it has none.
+func (t *invocationTracker) invocationID(path string) string {
+	for _, attr := range invocationAttrs {
+		value, err := t.fs.Getxattr(path, attr)
+		if err != nil {
+			continue
+		}
+		if len(value) == 16 {
+			// older systemd versions store the raw 128-bit ID
+			return hex.EncodeToString(value)
+		}
+		return string(value)
+	}
+	return ""
+}
+
+// collect exports the invocation ID of the cgroup at path.
+func (t *invocationTracker) collect(path string, labels []string, m chan<- prometheus.Metric) {
+	id := t.invocationID(path)
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	inv, ok := t.invocations[path]
+	if !ok {
+		inv = &invocation{id: id}
+		t.invocations[path] = inv
+	}
+	inv.missed = 0
+	if inv.id != id {
+		inv.id = id
+		inv.changes++
+	}
+	changes := inv.changes
+	t.mu.Unlock()
+	m <- prometheus.MustNewConstMetric(t.info, prometheus.GaugeValue, 1, append([]string{id}, labels...)...)
+	m <- prometheus.MustNewConstMetric(t.changes, prometheus.CounterValue, changes, labels...)
+}
+
+// forget drops the cgroups that were not discovered during the last
+// invocationGrace scrapes, so the invocations of removed transient units don't
+// accumulate.
+func (t *invocationTracker) forget(cgroups map[string]*cgroupEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for path, inv := range t.invocations {
+		if _, ok := cgroups[path]; ok {
+			inv.missed = 0
+			continue
+		}
+		inv.missed++
+		if inv.missed >= invocationGrace {
+			delete(t.invocations, path)
+		}
+	}
+}
+
+// WithInvocationIDs exports the systemd invocation ID of each unit's cgroup
+// as cgroup_invocation_info, and counts its changes in
+// cgroup_invocation_changes_total. The invocation ID changes every time the
+// unit is restarted. The file system passed to New must implement XattrFS.
+func WithInvocationIDs() Option {
+	return func(c *cgroupCollector) {
+		xfs, ok := c.fs.(XattrFS)
+		if !ok {
+			slog.Warn("cgroup file system can't read extended attributes, not collecting invocation IDs")
+			return
+		}
+		c.invocations = &invocationTracker{fs: xfs, invocations: make(map[string]*invocation)}
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+type xattrfs struct {
+	fstest.MapFS
+	xattrs map[string]string
+}
+
+func (x *xattrfs) Getxattr(name, attr string) ([]byte, error) {
+	value, ok := x.xattrs[name+":"+attr]
+	if !ok {
+		return nil, &fs.PathError{Op: "getxattr", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(value), nil
+}
+
+// collectInvocations returns the invocation_id and changes exported per cgroup.
+func collectInvocations(t *testing.T, c prometheus.Collector) (map[string]string, map[string]float64) {
+	t.Helper()
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	ids := make(map[string]string)
+	changes := make(map[string]float64)
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		labels := make(map[string]string)
+		for _, l := range dto.Label {
+			labels[*l.Name] = *l.Value
+		}
+		switch {
+		case strings.Contains(metric.Desc().String(), `"cgroup_invocation_info"`):
+			ids[labels["cgroup"]] = labels["invocation_id"]
+		case strings.Contains(metric.Desc().String(), `"cgroup_invocation_changes_total"`):
+			changes[labels["cgroup"]] = *dto.Counter.Value
+		}
+	}
+	return ids, changes
+}
+
+func TestInvocationIDs(t *testing.T) {
+	xfs := &xattrfs{
+		MapFS: fstest.MapFS{
+			"system.slice/nginx.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+			"system.slice/sshd.service/memory.current":  &fstest.MapFile{Data: []byte("1\n")},
+		},
+		xattrs: map[string]string{
+			"system.slice/nginx.service:trusted.invocation_id": "6a3e9e6b0c1f4d2e9a8b7c6d5e4f3a2b",
+			"system.slice/sshd.service:user.invocation_id":     "0f1e2d3c4b5a69788796a5b4c3d2e1f0",
+		},
+	}
+	c := New(xfs, "", WithInvocationIDs())
+
+	ids, changes := collectInvocations(t, c)
+	if ids["system.slice/nginx.service"] != "6a3e9e6b0c1f4d2e9a8b7c6d5e4f3a2b" {
+		t.Errorf("unexpected invocation ID %q", ids["system.slice/nginx.service"])
+	}
+	if ids["system.slice/sshd.service"] != "0f1e2d3c4b5a69788796a5b4c3d2e1f0" {
+		t.Errorf("unexpected invocation ID %q", ids["system.slice/sshd.service"])
+	}
+	if _, ok := ids["system.slice"]; ok {
+		t.Error("expected no invocation ID for system.slice")
+	}
+	if changes["system.slice/nginx.service"] != 0 {
+		t.Errorf("expected 0 changes got %f", changes["system.slice/nginx.service"])
+	}
+
+	xfs.xattrs["system.slice/nginx.service:trusted.invocation_id"] = "9b8a7c6d5e4f30211203f4e5d6c7b8a9"
+	ids, changes = collectInvocations(t, c)
+	if ids["system.slice/nginx.service"] != "9b8a7c6d5e4f30211203f4e5d6c7b8a9" {
+		t.Errorf("unexpected invocation ID %q", ids["system.slice/nginx.service"])
+	}
+	if changes["system.slice/nginx.service"] != 1 {
+		t.Errorf("expected 1 change got %f", changes["system.slice/nginx.service"])
+	}
+	if changes["system.slice/sshd.service"] != 0 {
+		t.Errorf("expected 0 changes got %f", changes["system.slice/sshd.service"])
+	}
+}
+
+func TestInvocationsOfRestartedUnitsAreKept(t *testing.T) {
+	cgroupfs := fstest.MapFS{
+		"system.slice/nginx.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	xfs := &xattrfs{
+		MapFS: cgroupfs,
+		xattrs: map[string]string{
+			"system.slice/nginx.service:user.invocation_id": "6a3e9e6b0c1f4d2e9a8b7c6d5e4f3a2b",
+		},
+	}
+	c := New(xfs, "", WithInvocationIDs())
+	collectInvocations(t, c)
+
+	// the cgroup is missing during a scrape while the unit restarts
+	file := cgroupfs["system.slice/nginx.service/memory.current"]
+	delete(cgroupfs, "system.slice/nginx.service/memory.current")
+	collectInvocations(t, c)
+	cgroupfs["system.slice/nginx.service/memory.current"] = file
+	xfs.xattrs["system.slice/nginx.service:user.invocation_id"] = "9b8a7c6d5e4f30211203f4e5d6c7b8a9"
+	if _, changes := collectInvocations(t, c); changes["system.slice/nginx.service"] != 1 {
+		t.Errorf("expected the restart to be counted got %f", changes["system.slice/nginx.service"])
+	}
+
+	delete(cgroupfs, "system.slice/nginx.service/memory.current")
+	for range invocationGrace {
+		collectInvocations(t, c)
+	}
+	if n := len(c.(*cgroupCollector).invocations.invocations); n != 0 {
+		t.Errorf("expected the removed unit to be forgotten got %d invocations", n)
+	}
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits bound the number of cgroups and series exported per scrape, so a
+// burst of transient cgroups can't overload the TSDB. A limit of 0 means
+// unlimited.
+//
+// When a limit is hit the cgroups with the lowest priority are dropped: the
+// cgroups below the first Priority pattern are kept first, then those below
+// the second and so on, then the cgroups not below any pattern. Within each
+// group shallower cgroups are kept first, then the cgroups are kept in path
+// order. Once a cgroup doesn't fit, it and all cgroups with lower priority are
+// dropped, so the same cgroups are dropped on every scrape.
+type Limits struct {
+	MaxCgroups int      `json:"max_cgroups"`
+	MaxSeries  int      `json:"max_series"`
+	Priority   []string `json:"priority"`
+}
+
+func (l Limits) isZero() bool {
+	return l.MaxCgroups == 0 && l.MaxSeries == 0 && len(l.Priority) == 0
+}
+
+func (l Limits) validate() error {
+	if l.MaxCgroups < 0 {
+		return fmt.Errorf("max_cgroups must not be negative")
+	}
+	if l.MaxSeries < 0 {
+		return fmt.Errorf("max_series must not be negative")
+	}
+	for _, p := range l.Priority {
+		if err := ValidatePattern(p); err != nil {
+			return fmt.Errorf("priority %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// limiter enforces Limits and counts what it dropped.
+type limiter struct {
+	Limits
+	priority []pattern
+
+	seriesLimitHits *prometheus.Desc
+	droppedCgroups  *prometheus.Desc
+
+	mu      sync.Mutex
+	hits    float64
+	cgroups float64
+}
+
+// rank returns the index of the first priority pattern matching the cgroup or
+// one of its ancestors, or the number of patterns if none does.
+func (l *limiter) rank(cgroup string) int {
+	elems := splitPath(cgroup)
+	for i, p := range l.priority {
+		for n := len(elems); n > 0; n-- {
+			if matchElems(p, elems[:n]) {
+				return i
+			}
+		}
+	}
+	return len(l.priority)
+}
+
+// collect exports the metrics gatherCgroups returns for the cgroups in order
+// of priority until a limit is hit. The cgroups are gathered batch at a time,
+// so only the metrics of a batch are held at once. The cgroups past
+// MaxCgroups are dropped without being read. Once a cgroup exceeds MaxSeries,
+// it and the cgroups after it are dropped, and those after it are not read.
+func (l *limiter) collect(cgroups []*cgroupEntry, batch int, gatherCgroups func([]*cgroupEntry) [][]prometheus.Metric, m chan<- prometheus.Metric) {
+	ranks := make(map[*cgroupEntry]int, len(cgroups))
+	for _, cgroup := range cgroups {
+		ranks[cgroup] = l.rank(cgroup.path)
+	}
+	cgroups = slices.Clone(cgroups)
+	slices.SortStableFunc(cgroups, func(a, b *cgroupEntry) int {
+		return cmp.Or(
+			cmp.Compare(ranks[a], ranks[b]),
+			cmp.Compare(depth(a.path), depth(b.path)),
+			cmp.Compare(a.path, b.path),
+		)
+	})
+
+	var series, droppedCgroups int
+	var limitHit bool
+	if l.MaxCgroups > 0 && len(cgroups) > l.MaxCgroups {
+		droppedCgroups = len(cgroups) - l.MaxCgroups
+		cgroups = cgroups[:l.MaxCgroups]
+	}
+	batch = max(batch, 1)
+gather:
+	for start := 0; start < len(cgroups); start += batch {
+		for i, metrics := range gatherCgroups(cgroups[start:min(start+batch, len(cgroups))]) {
+			if l.MaxSeries > 0 && series+len(metrics) > l.MaxSeries {
+				limitHit = true
+				droppedCgroups += len(cgroups) - start - i
+				break gather
+			}
+			series += len(metrics)
+			for _, metric := range metrics {
+				m <- metric
+			}
+		}
+	}
+
+	l.mu.Lock()
+	if limitHit {
+		l.hits++
+	}
+	l.cgroups += float64(droppedCgroups)
+	seriesLimitHitsTotal, droppedCgroupsTotal := l.hits, l.cgroups
+	l.mu.Unlock()
+	m <- prometheus.MustNewConstMetric(l.seriesLimitHits, prometheus.CounterValue, seriesLimitHitsTotal)
+	m <- prometheus.MustNewConstMetric(l.droppedCgroups, prometheus.CounterValue, droppedCgroupsTotal)
+}
+
+// WithLimits limits the cgroups and series exported per scrape, see Limits.
+// The cgroups dropped are counted in cgroup_exporter_dropped_cgroups_total,
+// and the scrapes that hit MaxSeries in
+// cgroup_exporter_series_limit_hits_total. The series dropped are not counted,
+// as the dropped cgroups are not read. WithLimits panics if a priority pattern
+// is malformed, see ValidatePattern.
+func WithLimits(limits Limits) Option {
+	return func(c *cgroupCollector) {
+		c.limits = &limiter{
+			Limits:          limits,
+			priority:        mustCompilePatterns(limits.Priority),
+			seriesLimitHits: prometheus.NewDesc("cgroup_exporter_series_limit_hits_total", "Number of scrapes that hit the series limit and dropped cgroups.", nil, nil),
+			droppedCgroups:  prometheus.NewDesc("cgroup_exporter_dropped_cgroups_total", "Number of cgroups not exported because a limit was hit.", nil, nil),
+		}
+	}
+}
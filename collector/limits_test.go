@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// collectLimited returns the cgroups exported by c in order, the number of
+// scrapes that hit the series limit and the number of cgroups its limiter
+// dropped.
+func collectLimited(t *testing.T, c *cgroupCollector) (cgroups []string, seriesLimitHits, droppedCgroups float64) {
+	t.Helper()
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		switch metric.Desc() {
+		case c.limits.seriesLimitHits:
+			seriesLimitHits = *dto.Counter.Value
+		case c.limits.droppedCgroups:
+			droppedCgroups = *dto.Counter.Value
+		default:
+			for _, l := range dto.Label {
+				if *l.Name == "cgroup" && !slices.Contains(cgroups, *l.Value) {
+					cgroups = append(cgroups, *l.Value)
+				}
+			}
+		}
+	}
+	return cgroups, seriesLimitHits, droppedCgroups
+}
+
+var limitsfs = fstest.MapFS{
+	"system.slice/memory.current":                               &fstest.MapFile{Data: []byte("1\n")},
+	"system.slice/memory.max":                                   &fstest.MapFile{Data: []byte("2\n")},
+	"system.slice/nginx.service/memory.current":                 &fstest.MapFile{Data: []byte("1\n")},
+	"ci.slice/memory.current":                                   &fstest.MapFile{Data: []byte("1\n")},
+	"ci.slice/runner-1.scope/memory.current":                    &fstest.MapFile{Data: []byte("1\n")},
+	"ci.slice/runner-2.scope/memory.current":                    &fstest.MapFile{Data: []byte("1\n")},
+	"user.slice/user-1000.slice/session-2.scope/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+}
+
+func TestLimitsDropDeepestFirst(t *testing.T) {
+	c := New(limitsfs, "", WithLimits(Limits{MaxCgroups: 5})).(*cgroupCollector)
+	cgroups, seriesLimitHits, droppedCgroups := collectLimited(t, c)
+	// user.slice has no files, but counts as a cgroup
+	expected := []string{"ci.slice", "system.slice", "ci.slice/runner-1.scope", "ci.slice/runner-2.scope"}
+	if !slices.Equal(cgroups, expected) {
+		t.Errorf("expected %v got %v", expected, cgroups)
+	}
+	if seriesLimitHits != 0 || droppedCgroups != 3 {
+		t.Errorf("expected no series limit hits and 3 dropped cgroups got %f and %f", seriesLimitHits, droppedCgroups)
+	}
+
+	// the counters accumulate across scrapes
+	_, seriesLimitHits, droppedCgroups = collectLimited(t, c)
+	if seriesLimitHits != 0 || droppedCgroups != 6 {
+		t.Errorf("expected no series limit hits and 6 dropped cgroups got %f and %f", seriesLimitHits, droppedCgroups)
+	}
+}
+
+func TestLimitsPriority(t *testing.T) {
+	c := New(limitsfs, "", WithLimits(Limits{MaxSeries: 4, Priority: []string{"system.slice", "user.slice"}})).(*cgroupCollector)
+	cgroups, seriesLimitHits, droppedCgroups := collectLimited(t, c)
+	// system.slice and user.slice fill the budget, so the cgroups of
+	// ci.slice no longer fit
+	expected := []string{"system.slice", "system.slice/nginx.service", "user.slice/user-1000.slice/session-2.scope"}
+	if !slices.Equal(cgroups, expected) {
+		t.Errorf("expected %v got %v", expected, cgroups)
+	}
+	// only ci.slice is read, its runners are dropped without reading them
+	if seriesLimitHits != 1 || droppedCgroups != 3 {
+		t.Errorf("expected 1 series limit hit and 3 dropped cgroups got %f and %f", seriesLimitHits, droppedCgroups)
+	}
+
+	_, seriesLimitHits, _ = collectLimited(t, c)
+	if seriesLimitHits != 2 {
+		t.Errorf("expected 2 series limit hits got %f", seriesLimitHits)
+	}
+}
+
+func TestLimitsSkipReadingDroppedCgroups(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		fsys := &countingfs{FS: limitsfs, opens: make(map[string]int)}
+		c := New(fsys, "", WithWorkers(workers), WithLimits(Limits{MaxCgroups: 2})).(*cgroupCollector)
+		cgroups, _, droppedCgroups := collectLimited(t, c)
+		if !slices.Equal(cgroups, []string{"ci.slice", "system.slice"}) || droppedCgroups != 6 {
+			t.Errorf("%d workers: expected ci.slice and system.slice and 6 dropped cgroups got %v and %f", workers, cgroups, droppedCgroups)
+		}
+		for _, cgroup := range []string{"system.slice/nginx.service", "ci.slice/runner-1.scope", "user.slice/user-1000.slice/session-2.scope"} {
+			if n := fsys.count(cgroup); n != 0 {
+				t.Errorf("%d workers: expected the dropped %s not to be read got %d reads", workers, cgroup, n)
+			}
+		}
+	}
+}
+
+func TestLimitsUnlimited(t *testing.T) {
+	c := New(limitsfs, "", WithLimits(Limits{Priority: []string{"ci.slice/**"}})).(*cgroupCollector)
+	cgroups, seriesLimitHits, droppedCgroups := collectLimited(t, c)
+	if len(cgroups) != 6 || cgroups[0] != "ci.slice" {
+		t.Errorf("expected the 6 cgroups with files with ci.slice first got %v", cgroups)
+	}
+	if seriesLimitHits != 0 || droppedCgroups != 0 {
+		t.Errorf("expected nothing dropped got %f and %f", seriesLimitHits, droppedCgroups)
+	}
+}
+
+func TestLoadConfigLimits(t *testing.T) {
+	config, err := LoadConfig(writeConfig(t, `{"limits": {"max_series": 100000, "priority": ["system.slice"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Limits.MaxSeries != 100000 {
+		t.Errorf("unexpected limits %+v", config.Limits)
+	}
+	for _, config := range []string{
+		`{"limits": {"max_cgroups": -1}}`,
+		`{"limits": {"priority": ["[a-"]}}`,
+	} {
+		if _, err := LoadConfig(writeConfig(t, config)); err == nil {
+			t.Errorf("%s: expected error", config)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"bufio"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// machineUnit matches the units of machines registered with
+// systemd-machined: the scopes machined creates for VMs and containers, and
+// the services of systemd-nspawn containers.
+var machineUnit = regexp.MustCompile(`^(?:machine-(.+)\.scope|systemd-nspawn@(.+)\.service)$`)
+
+// unescapeUnitName reverses the \xNN escaping systemd applies to characters
+// that are not allowed in unit names, such as "-" in machine names.
+func unescapeUnitName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// machineName matches the names machined accepts for machines: hostnames of
+// at most 64 characters, so they can't contain "/" or be "..".
+var machineName = regexp.MustCompile(`^[a-zA-Z0-9_-]+(?:\.[a-zA-Z0-9_-]+)*$`)
+
+func validMachineName(name string) bool {
+	return len(name) <= 64 && machineName.MatchString(name)
+}
+
+// parseMachine returns the name of the machine the cgroup belongs to, and the
+// class implied by its unit, if any. Units with names machined doesn't accept
+// are not machines.
+func parseMachine(cgroup string) (name, class string, ok bool) {
+	elems := strings.Split(cgroup, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		m := machineUnit.FindStringSubmatch(elems[i])
+		if m == nil {
+			continue
+		}
+		name = unescapeUnitName(m[1] + m[2])
+		if !validMachineName(name) {
+			return "", "", false
+		}
+		if m[2] != "" {
+			return name, "container", true
+		}
+		if strings.HasPrefix(name, "qemu-") {
+			// libvirt names its machines qemu-<id>-<domain>
+			class = "vm"
+		}
+		return name, class, true
+	}
+	return "", "", false
+}
+
+// machineResolver reads the names and classes of machines from the state
+// files machined keeps in run/systemd/machines below root. A state file is
+// parsed again whenever its modification time or size changes, and forgotten
+// once no cgroup of the machine is labeled during a scrape.
+type machineResolver struct {
+	root fs.FS
+
+	mu       sync.Mutex
+	scrape   uint64
+	machines map[string]machineState
+}
+
+type machineState struct {
+	modTime     time.Time
+	size        int64
+	name, class string
+	scrape      uint64
+}
+
+// newScrape forgets the machines that were not looked up since the last
+// scrape.
+func (r *machineResolver) newScrape() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for machine, m := range r.machines {
+		if m.scrape != r.scrape {
+			delete(r.machines, machine)
+		}
+	}
+	r.scrape++
+}
+
+// lookup returns the name and class of the machine in its state file, or
+// empty strings if there is none. The state file is read without holding r.mu.
+func (r *machineResolver) lookup(machine string) (name, class string) {
+	file := path.Join("run/systemd/machines", machine)
+	info, err := fs.Stat(r.root, file)
+	if err != nil {
+		slog.Debug("failed to read machine state", "machine", machine, "error", err)
+		r.mu.Lock()
+		delete(r.machines, machine)
+		r.mu.Unlock()
+		return "", ""
+	}
+	r.mu.Lock()
+	m, ok := r.machines[machine]
+	r.mu.Unlock()
+	if !ok || !info.ModTime().Equal(m.modTime) || info.Size() != m.size {
+		state, err := readMachineState(r.root, file)
+		if err != nil {
+			slog.Debug("failed to read machine state", "machine", machine, "error", err)
+			return "", ""
+		}
+		m = machineState{modTime: info.ModTime(), size: info.Size(), name: state["NAME"], class: state["CLASS"]}
+	}
+	r.mu.Lock()
+	m.scrape = r.scrape
+	r.machines[machine] = m
+	r.mu.Unlock()
+	return m.name, m.class
+}
+
+// readMachineState reads a KEY=VALUE state file of machined.
+func readMachineState(root fs.FS, file string) (map[string]string, error) {
+	f, err := root.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	state := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if k, v, ok := strings.Cut(scanner.Text(), "="); ok {
+			state[k] = v
+		}
+	}
+	return state, scanner.Err()
+}
+
+// WithMachineLabels adds machine and machine_class labels to the cgroups of
+// VMs and containers registered with systemd-machined. If root is not nil,
+// names and classes are read from the machined state files below root, which
+// should be the host's root directory.
+func WithMachineLabels(root fs.FS) Option {
+	return func(c *cgroupCollector) {
+		var resolver *machineResolver
+		var newScrape func()
+		if root != nil {
+			resolver = &machineResolver{root: root, machines: make(map[string]machineState)}
+			newScrape = resolver.newScrape
+		}
+		c.labelers = append(c.labelers, labeler{
+			names: []string{"machine", "machine_class"},
+			values: func(cgroup string) []string {
+				name, class, ok := parseMachine(cgroup)
+				if !ok {
+					return []string{"", ""}
+				}
+				if resolver != nil {
+					stateName, stateClass := resolver.lookup(name)
+					if stateName != "" {
+						name = stateName
+					}
+					if stateClass != "" {
+						class = stateClass
+					}
+				}
+				return []string{name, class}
+			},
+			newScrape: newScrape,
+		})
+	}
+}
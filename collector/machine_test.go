@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseMachine(t *testing.T) {
+	tests := []struct {
+		cgroup string
+		name   string
+		class  string
+	}{
+		{`machine.slice/machine-qemu\x2d1\x2dweb01.scope`, "qemu-1-web01", "vm"},
+		{`machine.slice/machine-qemu\x2d1\x2dweb01.scope/libvirt/emulator`, "qemu-1-web01", "vm"},
+		{`machine.slice/systemd-nspawn@build\x2dbox.service`, "build-box", "container"},
+		{`machine.slice/machine-build\x2dbox.scope`, "build-box", ""},
+		{`machine.slice`, "", ""},
+		{`machine.slice/machine-\x2e\x2e\x2f\x2e\x2e\x2fetc\x2fos-release.scope`, "", ""},
+		{`machine.slice/systemd-nspawn@\x2e\x2e.service`, "", ""},
+	}
+	for _, tt := range tests {
+		name, class, _ := parseMachine(tt.cgroup)
+		if name != tt.name || class != tt.class {
+			t.Errorf("%s: expected %q %q got %q %q", tt.cgroup, tt.name, tt.class, name, class)
+		}
+	}
+}
+
+func TestMachineLabels(t *testing.T) {
+	root := fstest.MapFS{
+		"run/systemd/machines/build-box": &fstest.MapFile{Data: []byte("# This is private data. Do not parse.\nNAME=build-box\nSCOPE=machine-build\\x2dbox.scope\nSERVICE=nspawn\nCLASS=container\n")},
+	}
+	c := New(cgroup, "", WithMachineLabels(root)).(*cgroupCollector)
+	labels := c.labels(`machine.slice/machine-build\x2dbox.scope`)
+	if labels[1] != "build-box" || labels[2] != "container" {
+		t.Errorf("expected build-box container got %q", labels)
+	}
+}
+
+func TestMachineLabelsRejectInvalidNames(t *testing.T) {
+	root := fstest.MapFS{
+		"etc/os-release": &fstest.MapFile{Data: []byte("NAME=NixOS\n")},
+	}
+	c := New(cgroup, "", WithMachineLabels(root)).(*cgroupCollector)
+	labels := c.labels(`machine.slice/machine-\x2e\x2e\x2f\x2e\x2e\x2fetc\x2fos-release.scope`)
+	if labels[1] != "" || labels[2] != "" {
+		t.Errorf("expected no machine labels got %q", labels)
+	}
+}
+
+func TestMachineStateIsCached(t *testing.T) {
+	root := fstest.MapFS{
+		"run/systemd/machines/build-box": &fstest.MapFile{Data: []byte("NAME=build-box\nCLASS=container\n")},
+	}
+	r := &machineResolver{root: root, machines: make(map[string]machineState)}
+	if name, class := r.lookup("build-box"); name != "build-box" || class != "container" {
+		t.Errorf("expected build-box container got %q %q", name, class)
+	}
+	// same size and modification time, so the file isn't parsed again
+	root["run/systemd/machines/build-box"].Data = []byte("NAME=build-box\nCLASS=vmvmvmvmv\n")
+	if _, class := r.lookup("build-box"); class != "container" {
+		t.Errorf("expected the cached class got %q", class)
+	}
+	root["run/systemd/machines/build-box"].Data = []byte("NAME=build-box\nCLASS=vm\n")
+	if _, class := r.lookup("build-box"); class != "vm" {
+		t.Errorf("expected the state to be read again got %q", class)
+	}
+	delete(root, "run/systemd/machines/build-box")
+	if name, _ := r.lookup("build-box"); name != "" || len(r.machines) != 0 {
+		t.Errorf("expected the removed machine to be forgotten got %q", name)
+	}
+
+	root["run/systemd/machines/build-box"] = &fstest.MapFile{Data: []byte("NAME=build-box\nCLASS=container\n")}
+	r.lookup("build-box")
+	r.newScrape()
+	if len(r.machines) != 1 {
+		t.Error("expected the machine looked up during the last scrape to be kept")
+	}
+	r.newScrape()
+	if len(r.machines) != 0 {
+		t.Error("expected the machine not looked up during the last scrape to be forgotten")
+	}
+}
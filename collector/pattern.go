@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"path"
+	"strings"
+)
+
+// pattern is a path pattern in the syntax of path.Match, except that an
+// element of just "**" matches any number of path elements, including none.
+type pattern []string
+
+// ValidatePattern reports whether p is a well-formed pattern.
+func ValidatePattern(p string) error {
+	_, err := compilePattern(p)
+	return err
+}
+
+func compilePattern(p string) (pattern, error) {
+	var elems pattern
+	for _, elem := range strings.Split(p, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return nil, err
+		}
+		// a run of ** matches what a single one does
+		if elem == "**" && len(elems) > 0 && elems[len(elems)-1] == "**" {
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+func mustCompilePatterns(ps []string) []pattern {
+	patterns := make([]pattern, len(ps))
+	for i, p := range ps {
+		var err error
+		if patterns[i], err = compilePattern(p); err != nil {
+			panic(err)
+		}
+	}
+	return patterns
+}
+
+// splitPath splits a slash-separated path relative to the cgroupfs root into
+// its elements. The root itself has none.
+func splitPath(name string) []string {
+	if name == "." {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// match reports whether name matches the pattern.
+func (p pattern) match(name string) bool {
+	return matchElems(p, splitPath(name))
+}
+
+// matchBelow reports whether some path below dir could match the pattern, so
+// dir has to be walked.
+func (p pattern) matchBelow(dir string) bool {
+	return matchPrefix(p, splitPath(dir))
+}
+
+// matchElems reports whether the pattern matches the path elements. It fills
+// in whether each suffix of p matches each suffix of elems, one row per
+// element of p, so it takes O(len(p)*len(elems)) steps however many ** p has.
+func matchElems(p pattern, elems []string) bool {
+	// next[j] is whether p[i+1:] matches elems[j:], cur[j] whether p[i:] does
+	next := make([]bool, len(elems)+1)
+	cur := make([]bool, len(elems)+1)
+	next[len(elems)] = true
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] == "**" {
+			cur[len(elems)] = next[len(elems)]
+			for j := len(elems) - 1; j >= 0; j-- {
+				cur[j] = next[j] || cur[j+1]
+			}
+		} else {
+			cur[len(elems)] = false
+			for j := len(elems) - 1; j >= 0; j-- {
+				if next[j+1] {
+					ok, _ := path.Match(p[i], elems[j])
+					cur[j] = ok
+				} else {
+					cur[j] = false
+				}
+			}
+		}
+		next, cur = cur, next
+	}
+	return next[0]
+}
+
+func matchPrefix(p pattern, elems []string) bool {
+	if len(elems) == 0 {
+		return len(p) > 0
+	}
+	if len(p) == 0 {
+		return false
+	}
+	if p[0] == "**" {
+		return true
+	}
+	ok, _ := path.Match(p[0], elems[0])
+	return ok && matchPrefix(p[1:], elems[1:])
+}
+
+// WithInclude collects the cgroups matching any of the patterns, and their
+// descendants. Patterns matching files collect only those files. The glob
+// passed to New is included too. If no pattern is included, all cgroups are
+// collected. WithInclude panics if a pattern is malformed, see
+// ValidatePattern.
+func WithInclude(patterns ...string) Option {
+	return func(c *cgroupCollector) {
+		c.includes = append(c.includes, mustCompilePatterns(patterns)...)
+	}
+}
+
+// WithExclude skips the cgroups matching any of the patterns, and their
+// descendants. Excluded subtrees are not walked. WithExclude panics if a
+// pattern is malformed, see ValidatePattern.
+func WithExclude(patterns ...string) Option {
+	return func(c *cgroupCollector) {
+		c.excludes = append(c.excludes, mustCompilePatterns(patterns)...)
+	}
+}
+
+// WithMaxDepth skips the cgroups more than depth levels below the root of the
+// hierarchy, e.g. system.slice/foo.service is 2 levels deep.
+func WithMaxDepth(depth int) Option {
+	return func(c *cgroupCollector) {
+		c.maxDepth = depth
+	}
+}
@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"system.slice", "system.slice", true},
+		{"*", "system.slice", true},
+		{"*", "system.slice/foo.service", false},
+		{"system.slice/**", "system.slice", true},
+		{"system.slice/**", "system.slice/foo.service/bar", true},
+		{"**/*.scope", "user.slice/user-1000.slice/session-2.scope", true},
+		{"**/*.scope", "init.scope", true},
+		{"**/*.scope", "system.slice", false},
+		{"user.slice/**/app-*.scope", "user.slice/user-1000.slice/user@1000.service/app.slice/app-foot.scope", true},
+		{"system.slice/systemd-*", "system.slice/systemd-journald.service", true},
+		{"**/**/*.scope", "init.scope", true},
+		{"**/a/**/b/**", "x/a/y/b", true},
+		{"**/a/**/b/**", "x/b/y/a", false},
+		{"**", ".", true},
+	}
+	for _, tt := range tests {
+		p, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.match(tt.name) != tt.match {
+			t.Errorf("%s %s: expected %v", tt.pattern, tt.name, tt.match)
+		}
+	}
+}
+
+func TestPatternMatchTakesPolynomialTime(t *testing.T) {
+	// not compiled, so the runs of ** are not collapsed
+	p := pattern(strings.Split(strings.Repeat("**/", 64)+"nomatch", "/"))
+	name := strings.Repeat("a/", 63) + "a"
+	done := make(chan bool)
+	go func() {
+		done <- p.match(name)
+	}()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("expected no match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the match to finish")
+	}
+	compiled, err := compilePattern(strings.Repeat("**/", 16) + "nomatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(compiled, pattern{"**", "nomatch"}) {
+		t.Errorf("expected the runs of ** to be collapsed got %q", compiled)
+	}
+}
+
+func TestPatternMatchBelow(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		below   bool
+	}{
+		{"system.slice/*.service", "system.slice", true},
+		{"system.slice/*.service", "user.slice", false},
+		{"system.slice/*.service", "system.slice/foo.service", false},
+		{"**/*.scope", "user.slice/user-1000.slice", true},
+		{"*", ".", true},
+	}
+	for _, tt := range tests {
+		p, err := compilePattern(tt.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.matchBelow(tt.dir) != tt.below {
+			t.Errorf("%s %s: expected %v", tt.pattern, tt.dir, tt.below)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	if err := ValidatePattern("system.slice/[a-"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+// openfs records the names that are opened.
+type openfs struct {
+	fs.FS
+	opened []string
+}
+
+func (o *openfs) Open(name string) (fs.File, error) {
+	o.opened = append(o.opened, name)
+	return o.FS.Open(name)
+}
+
+func TestIncludeExcludeAndMaxDepth(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"memory.current":                                            &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/memory.current":                               &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/nginx.service/memory.current":                 &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/nginx.service/worker/memory.current":          &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/systemd-journald.service/memory.current":      &fstest.MapFile{Data: []byte("1\n")},
+		"user.slice/memory.current":                                 &fstest.MapFile{Data: []byte("1\n")},
+		"user.slice/user-1000.slice/session-2.scope/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	spy := &openfs{FS: mapfs}
+	c := New(spy, "system.slice", WithInclude("**/session-*.scope"), WithExclude("system.slice/systemd-*"), WithMaxDepth(2))
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	var cgroups []string
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		for _, l := range dto.Label {
+			if *l.Name == "cgroup" {
+				cgroups = append(cgroups, *l.Value)
+			}
+		}
+	}
+	slices.Sort(cgroups)
+	expected := []string{"system.slice", "system.slice/nginx.service"}
+	if !slices.Equal(cgroups, expected) {
+		t.Errorf("expected %v got %v", expected, cgroups)
+	}
+	for _, name := range spy.opened {
+		if name == "system.slice/systemd-journald.service" || name == "system.slice/nginx.service/worker" {
+			t.Errorf("expected %s to be pruned", name)
+		}
+	}
+
+	c = New(mapfs, "", WithInclude("**/session-*.scope"))
+	metrics = make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	cgroups = nil
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		for _, l := range dto.Label {
+			if *l.Name == "cgroup" {
+				cgroups = append(cgroups, *l.Value)
+			}
+		}
+	}
+	expected = []string{"user.slice/user-1000.slice/session-2.scope"}
+	if !slices.Equal(cgroups, expected) {
+		t.Errorf("expected %v got %v", expected, cgroups)
+	}
+}
+
+func TestIncludeFilePattern(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.current":           &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/memory.max":               &fstest.MapFile{Data: []byte("2\n")},
+		"system.slice/nginx.service/memory.max": &fstest.MapFile{Data: []byte("3\n")},
+	}
+	c := New(mapfs, "*/memory.current")
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	n := 0
+	for metric := range metrics {
+		n++
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		if *dto.Gauge.Value != 1 {
+			t.Errorf("expected only memory.current got %f", *dto.Gauge.Value)
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected 1 metric got %d", n)
+	}
+}
@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// populated reports whether the cgroup at cgroup or one of its descendants
+// has processes in it, according to the populated key of its cgroup.events.
+// Cgroups without cgroup.events, like the root cgroup, are populated.
+func (c *cgroupCollector) populated(cgroup string) bool {
+	f, err := c.fs.Open(path.Join(cgroup, "cgroup.events"))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.report("cgroup.events", reasonOpen, err)
+		}
+		return true
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), " "); ok && key == "populated" {
+			return value != "0"
+		}
+	}
+	return true
+}
+
+// WithSkipUnpopulated skips the cgroups without processes in them or their
+// descendants, such as the cgroups of stopped services, so the exported
+// series follow what is running. If info is set, the cgroup_info of the
+// unpopulated cgroups is still exported, but not that of their descendants.
+func WithSkipUnpopulated(info bool) Option {
+	return func(c *cgroupCollector) {
+		c.skipUnpopulated = true
+		c.unpopulatedInfo = info
+	}
+}
@@ -0,0 +1,24 @@
+package collector
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestPopulated(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"running.service/cgroup.events": &fstest.MapFile{Data: []byte("populated 1\nfrozen 0\n")},
+		"stopped.service/cgroup.events": &fstest.MapFile{Data: []byte("populated 0\nfrozen 0\n")},
+	}
+	tests := map[string]bool{
+		"running.service": true,
+		"stopped.service": false,
+		".":               true,
+	}
+	c := New(mapfs, "").(*cgroupCollector)
+	for cgroup, expected := range tests {
+		if c.populated(cgroup) != expected {
+			t.Errorf("%s: expected %v", cgroup, expected)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package collector
+
+import (
+	"io/fs"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// TestSkipUnpopulated is Unix only, as it relies on cgroup_info.
+func TestSkipUnpopulated(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/nginx.service":                  &fstest.MapFile{Mode: fs.ModeDir, Sys: &syscall.Stat_t{Ino: 1}},
+		"system.slice/nginx.service/cgroup.events":    &fstest.MapFile{Data: []byte("populated 1\n")},
+		"system.slice/nginx.service/memory.current":   &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/stopped.service":                &fstest.MapFile{Mode: fs.ModeDir, Sys: &syscall.Stat_t{Ino: 2}},
+		"system.slice/stopped.service/cgroup.events":  &fstest.MapFile{Data: []byte("populated 0\n")},
+		"system.slice/stopped.service/memory.current": &fstest.MapFile{Data: []byte("0\n")},
+		"system.slice/stopped.service/child":          &fstest.MapFile{Mode: fs.ModeDir, Sys: &syscall.Stat_t{Ino: 3}},
+	}
+
+	values := collectValues(New(mapfs, "", WithSkipUnpopulated(false)).(*cgroupCollector))
+	expected := map[[2]string]float64{
+		{"cgroup_info", "system.slice/nginx.service"}:                 1,
+		{"cgroup_memory_current_bytes", "system.slice/nginx.service"}: 1,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+	for key := range expected {
+		if _, ok := values[key]; !ok {
+			t.Errorf("expected %v", key)
+		}
+	}
+
+	values = collectValues(New(mapfs, "", WithSkipUnpopulated(true)).(*cgroupCollector))
+	expected[[2]string{"cgroup_info", "system.slice/stopped.service"}] = 1
+	if len(values) != len(expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+	for key := range expected {
+		if _, ok := values[key]; !ok {
+			t.Errorf("expected %v", key)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Profile selects what to collect for the subtrees of the cgroups whose path
+// matches Match, a pattern in the syntax of path.Match in which "**" matches
+// any number of path elements. If a cgroup is in the
+// subtrees of several profiles, the profile matching its nearest ancestor
+// wins, and of profiles matching the same cgroup the first one wins. Cgroups
+// outside of any profile are collected as configured globally.
+type Profile struct {
+	Match string `json:"match"`
+	// Selection selects the files to collect. The default is all files.
+	Selection
+	// Metrics, if not empty, restricts collection to the named metric
+	// families. Files none of whose metrics are named are not opened.
+	Metrics []string `json:"metrics"`
+}
+
+func (p Profile) validate() error {
+	if err := ValidatePattern(p.Match); err != nil {
+		return err
+	}
+	if _, err := p.Files(); err != nil {
+		return err
+	}
+	for _, name := range p.Metrics {
+		if !slices.Contains(supportedMetrics, name) {
+			return fmt.Errorf("unknown metric %q", name)
+		}
+	}
+	return nil
+}
+
+// profile holds the files to collect for the cgroups of a Profile.
+type profile struct {
+	match              pattern
+	singleCollectors   map[string]collector
+	multipleCollectors map[string]multipleCollector
+}
+
+// newProfile selects the files and metrics of p from the collectors of c.
+func (c *cgroupCollector) newProfile(p Profile) (*profile, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	files, _ := p.Files()
+	selected := func(d *prometheus.Desc) bool {
+		return len(p.Metrics) == 0 || slices.Contains(p.Metrics, c.metricNames[d])
+	}
+	profile := &profile{
+		match:              strings.Split(p.Match, "/"),
+		singleCollectors:   make(map[string]collector),
+		multipleCollectors: make(map[string]multipleCollector),
+	}
+	for name, col := range c.singleCollectors {
+		if slices.Contains(files, name) && selected(col.desc) {
+			profile.singleCollectors[name] = col
+		}
+	}
+	for name, col := range c.multipleCollectors {
+		if !slices.Contains(files, name) {
+			continue
+		}
+		descs := make(map[string]desc)
+		for k, d := range col.descs {
+			if selected(d.desc) {
+				descs[k] = d
+			}
+		}
+		if len(descs) > 0 {
+			profile.multipleCollectors[name] = multipleCollector{descs: descs, collect: col.collect}
+		}
+	}
+	return profile, nil
+}
+
+// depth returns the number of elements of a cgroup path.
+func depth(cgroup string) int {
+	if cgroup == "." {
+		return 0
+	}
+	return strings.Count(cgroup, "/") + 1
+}
+
+// profile returns the profile of the cgroup, or nil if it has none.
+func (c *cgroupCollector) profile(cgroup string) *profile {
+	var best *profile
+	bestDepth := -1
+	for _, p := range c.profiles {
+		for dir, d := cgroup, depth(cgroup); d > bestDepth; dir, d = path.Dir(dir), d-1 {
+			if p.match.match(dir) {
+				best, bestDepth = p, d
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Metrics returns the sorted names of the metric families exported for the
+// supported files.
+func Metrics() []string {
+	return slices.Clone(supportedMetrics)
+}
+
+// WithProfiles selects what to collect per subtree of the hierarchy.
+func WithProfiles(profiles []Profile) Option {
+	return func(c *cgroupCollector) {
+		c.profileConfigs = profiles
+	}
+}
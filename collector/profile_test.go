@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProfiles(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"user.slice/memory.current":                                  &fstest.MapFile{Data: []byte("1\n")},
+		"user.slice/memory.stat":                                     &fstest.MapFile{Data: []byte("anon 1\nfile 2\n")},
+		"user.slice/cpu.stat":                                        &fstest.MapFile{Data: []byte("usage_usec 1\nuser_usec 1\nsystem_usec 0\n")},
+		"user.slice/user-1000.slice/session-2.scope/memory.current":  &fstest.MapFile{Data: []byte("1\n")},
+		"user.slice/user-1000.slice/session-2.scope/memory.stat":     &fstest.MapFile{Data: []byte("anon 1\nfile 2\n")},
+		"user.slice/user-1000.slice/user@1000.service/memory.stat":   &fstest.MapFile{Data: []byte("anon 1\nfile 2\n")},
+		"user.slice/user-1000.slice/user@1000.service/memory.events": &fstest.MapFile{Data: []byte("low 0\nhigh 0\n")},
+		"system.slice/memory.stat":                                   &fstest.MapFile{Data: []byte("anon 1\nfile 2\n")},
+	}
+	c := New(mapfs, "", WithFiles("memory.current"), WithProfiles([]Profile{
+		{Match: "user.slice", Metrics: []string{"cgroup_memory_current_bytes", "cgroup_cpu_usage_seconds_total"}},
+		{Match: "user.slice/*/user@*.service", Selection: Selection{Enable: []string{"memory"}, Preset: "minimal"}},
+		{Match: "user.slice/*/*", Selection: Selection{Preset: "minimal"}},
+	}))
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	var got []string
+	for metric := range metrics {
+		d := metric.Desc().String()
+		name := d[strings.Index(d, `"`)+1:]
+		name = name[:strings.Index(name, `"`)]
+		got = append(got, name)
+	}
+	expected := map[string]int{
+		// user.slice only gets the named metrics
+		"cgroup_memory_current_bytes":    2,
+		"cgroup_cpu_usage_seconds_total": 1,
+		// the first of the profiles matching user@1000.service wins
+		"cgroup_memory_anon_bytes":        1,
+		"cgroup_memory_file_bytes":        1,
+		"cgroup_memory_events_low_total":  1,
+		"cgroup_memory_events_high_total": 1,
+	}
+	counts := make(map[string]int)
+	for _, name := range got {
+		counts[name]++
+	}
+	for name, n := range expected {
+		if counts[name] != n {
+			t.Errorf("expected %d %s got %d", n, name, counts[name])
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("expected 7 metrics got %v", got)
+	}
+}
+
+func TestProfileValidation(t *testing.T) {
+	for _, p := range []Profile{
+		{Match: "["},
+		{Match: "user.slice", Metrics: []string{"cgroup_memory_foo"}},
+		{Match: "user.slice", Selection: Selection{Preset: "tiny"}},
+	} {
+		if err := p.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+}
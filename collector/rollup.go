@@ -0,0 +1,237 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// validateRollup reports whether p is a well-formed rollup pattern. Its last
+// element names the synthetic cgroup, so it can't be "**".
+func validateRollup(p string) error {
+	if err := ValidatePattern(p); err != nil {
+		return err
+	}
+	if path.Base(p) == "**" {
+		return fmt.Errorf("rollup %q must not end in **", p)
+	}
+	return nil
+}
+
+// rollups sum up the metrics of sibling cgroups matching a pattern into a
+// synthetic cgroup, named after the parent of the siblings and the last
+// element of the pattern, e.g. user.slice/user-1000.slice/session-*.scope.
+//
+// Gauges are summed. Counters are kept monotonic by remembering the last
+// values of the cgroups that disappeared, or whose counters were reset.
+type rollups struct {
+	patterns []pattern
+
+	mu     sync.Mutex
+	groups map[string]rollupCounters
+}
+
+type rollupKey struct {
+	desc   *prometheus.Desc
+	values string
+}
+
+// rollupCounters are the counters of a rollup.
+type rollupCounters map[rollupKey]*rollupCounter
+
+type rollupCounter struct {
+	// departed is the sum of the last values of the members that are gone.
+	departed float64
+	members  map[string]float64
+}
+
+// match returns the synthetic cgroup the cgroup rolls up into.
+func (r *rollups) match(cgroup string) (string, bool) {
+	for _, p := range r.patterns {
+		if p.match(cgroup) {
+			return path.Join(path.Dir(cgroup), p[len(p)-1]), true
+		}
+	}
+	return "", false
+}
+
+// below reports whether an ancestor of the cgroup is rolled up.
+func (r *rollups) below(cgroup string) bool {
+	elems := splitPath(cgroup)
+	for n := len(elems) - 1; n > 0; n-- {
+		for _, p := range r.patterns {
+			if matchElems(p, elems[:n]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rollUp replaces the discovered cgroups that match a rollup with their
+// synthetic cgroups, in place of their first member. The descendants of the
+// members are dropped, as their usage is already accounted to the members.
+func (c *cgroupCollector) rollUp(s *scrape) {
+	var order []*cgroupEntry
+	rollups := make(map[string]*cgroupEntry)
+	for _, cgroup := range s.order {
+		if c.rollups.below(cgroup.path) {
+			continue
+		}
+		name, ok := c.rollups.match(cgroup.path)
+		if !ok {
+			order = append(order, cgroup)
+			continue
+		}
+		rollup, ok := rollups[name]
+		if !ok {
+			rollup = &cgroupEntry{path: name, labels: c.labels(name)}
+			rollups[name] = rollup
+			s.rollups[name] = true
+			order = append(order, rollup)
+		}
+		rollup.members = append(rollup.members, cgroup)
+	}
+	s.order = order
+}
+
+// collectRollup collects the files of the members of the rollup and exports
+// their sums.
+func (c *cgroupCollector) collectRollup(rollup *cgroupEntry, m chan<- prometheus.Metric) {
+	type series struct {
+		valueType prometheus.ValueType
+		values    []string
+		value     float64
+		members   map[string]float64
+	}
+	var keys []rollupKey
+	sums := make(map[rollupKey]*series)
+	for _, member := range rollup.members {
+		metrics := gather(func(m chan<- prometheus.Metric) {
+			c.collectFiles(member, m)
+		})
+		for _, metric := range metrics {
+			dto := new(io_prometheus_client.Metric)
+			if err := metric.Write(dto); err != nil {
+				c.report("", reasonRollup, fmt.Errorf("failed to roll up %s: %w", rollup.path, err))
+				continue
+			}
+			desc := metric.Desc()
+			values := variableLabelValues(c.variableLabels[desc], dto.Label)
+			key := rollupKey{desc: desc, values: strings.Join(values, "\xff")}
+			sum, ok := sums[key]
+			if !ok {
+				sum = &series{valueType: prometheus.GaugeValue, values: values, members: make(map[string]float64)}
+				sums[key] = sum
+				keys = append(keys, key)
+			}
+			switch {
+			case dto.Counter != nil:
+				sum.valueType = prometheus.CounterValue
+				sum.members[member.path] += dto.Counter.GetValue()
+			case dto.Gauge != nil:
+				sum.value += dto.Gauge.GetValue()
+			case dto.Untyped != nil:
+				sum.valueType = prometheus.UntypedValue
+				sum.value += dto.Untyped.GetValue()
+			}
+		}
+	}
+
+	c.rollups.mu.Lock()
+	counters := c.rollups.groups[rollup.path]
+	if counters == nil {
+		counters = make(rollupCounters)
+		c.rollups.groups[rollup.path] = counters
+	}
+	for _, key := range keys {
+		if sum := sums[key]; sum.valueType == prometheus.CounterValue {
+			sum.value = counters.add(key, sum.members, !c.filtered && !c.deadline.wasTruncated())
+		}
+	}
+	c.rollups.mu.Unlock()
+
+	for _, key := range keys {
+		sum := sums[key]
+		m <- prometheus.MustNewConstMetric(key.desc, sum.valueType, sum.value, slices.Concat(sum.values, rollup.labels)...)
+	}
+}
+
+// add records the current counter values of the members of a rollup and
+// returns their monotonic sum. If complete, members are known to be gone when
+// they have no value.
+func (counters rollupCounters) add(key rollupKey, members map[string]float64, complete bool) float64 {
+	counter := counters[key]
+	if counter == nil {
+		counter = &rollupCounter{members: make(map[string]float64)}
+		counters[key] = counter
+	}
+	for member, last := range counter.members {
+		value, ok := members[member]
+		switch {
+		case !ok && complete:
+			counter.departed += last
+			delete(counter.members, member)
+		case ok && value < last:
+			// the member's counter was reset, e.g. the cgroup was recreated
+			counter.departed += last
+		}
+	}
+	sum := counter.departed
+	for member, value := range members {
+		counter.members[member] = value
+	}
+	for _, value := range counter.members {
+		sum += value
+	}
+	return sum
+}
+
+// forget drops the state of the rollups that were not discovered during a
+// scrape. Their series disappear, so their counters can start over.
+func (r *rollups) forget(seen map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.groups {
+		if !seen[name] {
+			delete(r.groups, name)
+		}
+	}
+}
+
+// variableLabelValues returns the values of the labels names in order.
+func variableLabelValues(names []string, labels []*io_prometheus_client.LabelPair) []string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		for _, l := range labels {
+			if l.GetName() == name {
+				values[i] = l.GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// WithRollups sums up the metrics of sibling cgroups matching any of the
+// patterns into one synthetic cgroup, to keep the signal of transient cgroups
+// like session-*.scope without the churn of their series. The cgroup_info and
+// invocation metrics of the siblings are not exported. WithRollups panics if a
+// pattern is malformed, see ValidatePattern.
+func WithRollups(patterns ...string) Option {
+	return func(c *cgroupCollector) {
+		for _, p := range patterns {
+			if err := validateRollup(p); err != nil {
+				panic(err)
+			}
+		}
+		c.rollups = &rollups{
+			patterns: mustCompilePatterns(patterns),
+			groups:   make(map[string]rollupCounters),
+		}
+	}
+}
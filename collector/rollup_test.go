@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+// collectValues returns the values of the metrics collected by c, by metric
+// name and cgroup.
+func collectValues(c *cgroupCollector) map[[2]string]float64 {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	values := make(map[[2]string]float64)
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		var cgroup string
+		for _, l := range dto.Label {
+			if *l.Name == "cgroup" {
+				cgroup = *l.Value
+			}
+		}
+		key := [2]string{c.metricNames[metric.Desc()], cgroup}
+		switch {
+		case dto.Counter != nil:
+			values[key] = *dto.Counter.Value
+		case dto.Gauge != nil:
+			values[key] = *dto.Gauge.Value
+		}
+	}
+	return values
+}
+
+func TestRollups(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"user.slice/user-1000.slice/memory.current":                       &fstest.MapFile{Data: []byte("5\n")},
+		"user.slice/user-1000.slice/session-1.scope/memory.current":       &fstest.MapFile{Data: []byte("10\n")},
+		"user.slice/user-1000.slice/session-1.scope/memory.events":        &fstest.MapFile{Data: []byte("oom_kill 1\n")},
+		"user.slice/user-1000.slice/session-2.scope/memory.current":       &fstest.MapFile{Data: []byte("20\n")},
+		"user.slice/user-1000.slice/session-2.scope/memory.events":        &fstest.MapFile{Data: []byte("oom_kill 2\n")},
+		"user.slice/user-1000.slice/session-2.scope/child/memory.current": &fstest.MapFile{Data: []byte("99\n")},
+	}
+	c := New(mapfs, "", WithRollups("user.slice/*/session-*.scope")).(*cgroupCollector)
+	rollup := "user.slice/user-1000.slice/session-*.scope"
+
+	values := collectValues(c)
+	expected := map[[2]string]float64{
+		{"cgroup_memory_current_bytes", "user.slice/user-1000.slice"}: 5,
+		{"cgroup_memory_current_bytes", rollup}:                       30,
+		{"cgroup_memory_events_oom_kill_total", rollup}:               3,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expected %v got %v", expected, values)
+	}
+	for key, value := range expected {
+		if values[key] != value {
+			t.Errorf("%v: expected %f got %f", key, value, values[key])
+		}
+	}
+
+	// session-1.scope is gone, its counters are remembered
+	delete(mapfs, "user.slice/user-1000.slice/session-1.scope/memory.current")
+	delete(mapfs, "user.slice/user-1000.slice/session-1.scope/memory.events")
+	mapfs["user.slice/user-1000.slice/session-2.scope/memory.events"] = &fstest.MapFile{Data: []byte("oom_kill 4\n")}
+	values = collectValues(c)
+	if v := values[[2]string{"cgroup_memory_current_bytes", rollup}]; v != 20 {
+		t.Errorf("expected gauge 20 got %f", v)
+	}
+	if v := values[[2]string{"cgroup_memory_events_oom_kill_total", rollup}]; v != 5 {
+		t.Errorf("expected counter 5 got %f", v)
+	}
+
+	// session-2.scope was recreated, its counters restart
+	mapfs["user.slice/user-1000.slice/session-2.scope/memory.events"] = &fstest.MapFile{Data: []byte("oom_kill 1\n")}
+	values = collectValues(c)
+	if v := values[[2]string{"cgroup_memory_events_oom_kill_total", rollup}]; v != 6 {
+		t.Errorf("expected counter 6 got %f", v)
+	}
+}
+
+func TestValidateRollup(t *testing.T) {
+	if err := validateRollup("user.slice/**"); err == nil {
+		t.Error("expected error")
+	}
+	if err := validateRollup("user.slice/*/session-*.scope"); err != nil {
+		t.Error(err)
+	}
+}
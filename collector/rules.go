@@ -0,0 +1,77 @@
+package collector
+
+import "slices"
+
+// LabelRule sets labels on the cgroups whose path matches Match. The label
+// values and Cgroup are expanded with regexp.Expand, so they can refer to the
+// capture groups of Match as $1 or ${name}.
+type LabelRule struct {
+	Match  Regexp            `json:"match"`
+	Labels map[string]string `json:"labels"`
+	// Cgroup replaces the cgroup label if it is not empty. Rules must not
+	// rewrite different cgroups to the same value, or their metrics collide.
+	Cgroup string `json:"cgroup"`
+}
+
+// labelRules applies the first matching LabelRule to a cgroup.
+type labelRules struct {
+	rules []LabelRule
+	names []string
+}
+
+func newLabelRules(rules []LabelRule) *labelRules {
+	r := &labelRules{rules: rules}
+	for _, rule := range rules {
+		for name := range rule.Labels {
+			if !slices.Contains(r.names, name) {
+				r.names = append(r.names, name)
+			}
+		}
+	}
+	slices.Sort(r.names)
+	return r
+}
+
+// match returns the first rule matching cgroup and its submatch indices.
+func (r *labelRules) match(cgroup string) (*LabelRule, []int) {
+	for i := range r.rules {
+		if m := r.rules[i].Match.FindStringSubmatchIndex(cgroup); m != nil {
+			return &r.rules[i], m
+		}
+	}
+	return nil, nil
+}
+
+func (r *labelRules) values(cgroup string) []string {
+	values := make([]string, len(r.names))
+	rule, m := r.match(cgroup)
+	if rule == nil {
+		return values
+	}
+	for i, name := range r.names {
+		if template, ok := rule.Labels[name]; ok {
+			values[i] = string(rule.Match.ExpandString(nil, template, cgroup, m))
+		}
+	}
+	return values
+}
+
+func (r *labelRules) rewrite(cgroup string) string {
+	rule, m := r.match(cgroup)
+	if rule == nil || rule.Cgroup == "" {
+		return cgroup
+	}
+	return string(rule.Match.ExpandString(nil, rule.Cgroup, cgroup, m))
+}
+
+// WithLabelRules sets labels from the capture groups of the first rule whose
+// regular expression matches the path of a cgroup, and optionally rewrites
+// its cgroup label. Rules are applied before any metric of the cgroup is
+// built.
+func WithLabelRules(rules []LabelRule) Option {
+	return func(c *cgroupCollector) {
+		r := newLabelRules(rules)
+		c.labelers = append(c.labelers, labeler{names: r.names, values: r.values})
+		c.rewrite = r.rewrite
+	}
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"testing"
+)
+
+func mustRegexp(t *testing.T, s string) Regexp {
+	t.Helper()
+	re, err := NewRegexp(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return re
+}
+
+func TestLabelRules(t *testing.T) {
+	rules := []LabelRule{
+		{
+			Match:  mustRegexp(t, `nomad\.slice/(?P<alloc>[0-9a-f-]+)\.(?P<task>[^/]+)\.scope`),
+			Labels: map[string]string{"alloc_id": "${alloc}", "task": "${task}"},
+			Cgroup: "nomad/${task}/${alloc}",
+		},
+		{
+			Match:  mustRegexp(t, `ci\.slice/runner-(\d+)\.scope(/.*)?`),
+			Labels: map[string]string{"runner": "$1"},
+		},
+	}
+	c := New(cgroup, "", WithLabelRules(rules)).(*cgroupCollector)
+
+	tests := []struct {
+		cgroup   string
+		expected []string
+	}{
+		// label names are sorted: alloc_id, runner, task
+		{"nomad.slice/8f3c2a1b-1111-2222-3333-444455556666.web.scope", []string{"nomad/web/8f3c2a1b-1111-2222-3333-444455556666", "8f3c2a1b-1111-2222-3333-444455556666", "", "web"}},
+		{"ci.slice/runner-12.scope", []string{"ci.slice/runner-12.scope", "", "12", ""}},
+		{"ci.slice/runner-12.scope/job.slice", []string{"ci.slice/runner-12.scope/job.slice", "", "12", ""}},
+		// matches are anchored
+		{"system.slice/ci.slice/runner-12.scope", []string{"system.slice/ci.slice/runner-12.scope", "", "", ""}},
+	}
+	for _, tt := range tests {
+		labels := c.labels(tt.cgroup)
+		if len(labels) != len(tt.expected) {
+			t.Fatalf("%s: expected %q got %q", tt.cgroup, tt.expected, labels)
+		}
+		for i := range labels {
+			if labels[i] != tt.expected[i] {
+				t.Errorf("%s: expected %q got %q", tt.cgroup, tt.expected, labels)
+				break
+			}
+		}
+	}
+}
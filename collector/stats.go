@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for which collecting a file fails. reasonLabel is for the files
+// read to label cgroups, like the configs of containers.
+const (
+	reasonWalk   = "walk"
+	reasonStat   = "stat"
+	reasonOpen   = "open"
+	reasonParse  = "parse"
+	reasonRollup = "rollup"
+	reasonLabel  = "label"
+)
+
+// stats observe the collector itself.
+type stats struct {
+	errors    *prometheus.Desc
+	duration  *prometheus.Desc
+	cgroups   *prometheus.Desc
+	filesRead *prometheus.Desc
+	vanished  *prometheus.Desc
+	truncated *prometheus.Desc
+
+	mu              sync.Mutex
+	errorCounts     map[errorKey]float64
+	files           float64
+	vanishedCgroups float64
+}
+
+type errorKey struct {
+	file, reason string
+}
+
+func newStats() *stats {
+	return &stats{
+		errors:      prometheus.NewDesc("cgroup_exporter_collect_errors_total", "Number of errors collecting cgroup files, by file name and reason.", []string{"file", "reason"}, nil),
+		duration:    prometheus.NewDesc("cgroup_exporter_scrape_duration_seconds", "Duration of the last scrape of the cgroups.", nil, nil),
+		cgroups:     prometheus.NewDesc("cgroup_exporter_cgroups_scanned", "Number of cgroups found by the last scrape.", nil, nil),
+		filesRead:   prometheus.NewDesc("cgroup_exporter_files_read_total", "Number of cgroup files read.", nil, nil),
+		vanished:    prometheus.NewDesc("cgroup_exporter_vanished_cgroups_total", "Number of cgroups removed while they were scraped.", nil, nil),
+		truncated:   prometheus.NewDesc("cgroup_exporter_scrape_truncated", "Whether the scrape was stopped by its deadline and only exports part of the cgroups.", nil, nil),
+		errorCounts: make(map[errorKey]float64),
+	}
+}
+
+func (s *stats) descs() []*prometheus.Desc {
+	return []*prometheus.Desc{s.errors, s.duration, s.cgroups, s.filesRead, s.vanished, s.truncated}
+}
+
+// fileRead counts a file read.
+func (s *stats) fileRead() {
+	s.mu.Lock()
+	s.files++
+	s.mu.Unlock()
+}
+
+// collect exports the stats of a scrape that found cgroups, took duration
+// and was truncated or not.
+func (s *stats) collect(duration time.Duration, cgroups int, truncated bool, m chan<- prometheus.Metric) {
+	s.mu.Lock()
+	for key, n := range s.errorCounts {
+		m <- prometheus.MustNewConstMetric(s.errors, prometheus.CounterValue, n, key.file, key.reason)
+	}
+	files, vanished := s.files, s.vanishedCgroups
+	s.mu.Unlock()
+	m <- prometheus.MustNewConstMetric(s.filesRead, prometheus.CounterValue, files)
+	m <- prometheus.MustNewConstMetric(s.vanished, prometheus.CounterValue, vanished)
+	m <- prometheus.MustNewConstMetric(s.cgroups, prometheus.GaugeValue, float64(cgroups))
+	m <- prometheus.MustNewConstMetric(s.duration, prometheus.GaugeValue, duration.Seconds())
+	truncatedValue := 0.0
+	if truncated {
+		truncatedValue = 1
+	}
+	m <- prometheus.MustNewConstMetric(s.truncated, prometheus.GaugeValue, truncatedValue)
+}
+
+// cgroupVanished counts a cgroup removed during a scrape.
+func (s *stats) cgroupVanished() {
+	s.mu.Lock()
+	s.vanishedCgroups++
+	s.mu.Unlock()
+}
+
+// report counts an error collecting file, the name of a cgroup file or empty
+// if the error is not about a file, and passes it to the error handler.
+func (c *cgroupCollector) report(file, reason string, err error) {
+	c.stats.mu.Lock()
+	c.stats.errorCounts[errorKey{file, reason}]++
+	c.stats.mu.Unlock()
+	c.errorHandler(err)
+}
+
+// labelErrorReporter returns the function the resolvers of labels report the
+// errors reading file with, which are counted like those of cgroup files.
+func (c *cgroupCollector) labelErrorReporter() func(file string, err error) {
+	return func(file string, err error) {
+		c.report(file, reasonLabel, err)
+	}
+}
+
+// logError is the default error handler.
+func logError(err error) {
+	slog.Error("failed to collect cgroup", "error", err)
+}
+
+// WithSelfMetrics exports metrics about the collector itself: the errors
+// collecting cgroup files in cgroup_exporter_collect_errors_total, the
+// duration of the last scrape, the number of cgroups it found, the number of
+// files read, the number of cgroups removed while they were scraped and
+// whether the scrape was truncated by its deadline.
+func WithSelfMetrics() Option {
+	return func(c *cgroupCollector) {
+		c.selfMetrics = true
+	}
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/prometheus/client_golang/prometheus"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"system.slice/memory.current":               &fstest.MapFile{Data: []byte("1\n")},
+		"system.slice/memory.min":                   &fstest.MapFile{Data: []byte("garbage\n")},
+		"system.slice/nginx.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+	}
+	c := New(mapfs, "", WithSelfMetrics()).(*cgroupCollector)
+	var errs []error
+	c.errorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		defer close(metrics)
+		c.Collect(metrics)
+	}()
+	values := make(map[*prometheus.Desc]float64)
+	var labels []*io_prometheus_client.LabelPair
+	for metric := range metrics {
+		dto := new(io_prometheus_client.Metric)
+		metric.Write(dto)
+		switch metric.Desc() {
+		case c.stats.errors:
+			values[c.stats.errors] = *dto.Counter.Value
+			labels = dto.Label
+		case c.stats.filesRead:
+			values[c.stats.filesRead] = *dto.Counter.Value
+		case c.stats.cgroups:
+			values[c.stats.cgroups] = *dto.Gauge.Value
+		case c.stats.duration:
+			values[c.stats.duration] = *dto.Gauge.Value
+		}
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error got %v", errs)
+	}
+	if values[c.stats.errors] != 1 || len(labels) != 2 || *labels[0].Value != "memory.min" || *labels[1].Value != reasonParse {
+		t.Errorf("expected a parse error of memory.min got %f %v", values[c.stats.errors], labels)
+	}
+	if values[c.stats.filesRead] != 3 {
+		t.Errorf("expected 3 files read got %f", values[c.stats.filesRead])
+	}
+	if values[c.stats.cgroups] != 2 {
+		t.Errorf("expected 2 cgroups got %f", values[c.stats.cgroups])
+	}
+	if _, ok := values[c.stats.duration]; !ok {
+		t.Error("expected the scrape duration")
+	}
+}
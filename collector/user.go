@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// userUnit matches the slices and services systemd-logind creates for each
+// user. The first submatch is the UID.
+var userUnit = regexp.MustCompile(`^(?:user-(\d+)\.slice|user@(\d+)\.service)$`)
+
+// parseUID returns the UID of the user the cgroup belongs to.
+func parseUID(cgroup string) (string, bool) {
+	elems := strings.Split(cgroup, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if m := userUnit.FindStringSubmatch(elems[i]); m != nil {
+			return m[1] + m[2], true
+		}
+	}
+	return "", false
+}
+
+// passwdResolver resolves UIDs to user names from an /etc/passwd file. The
+// file is parsed again whenever its modification time or size changes.
+type passwdResolver struct {
+	root fs.FS
+	// report reports the errors reading passwd.
+	report func(file string, err error)
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	users   map[string]string
+}
+
+func (r *passwdResolver) lookup(uid string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, err := fs.Stat(r.root, "etc/passwd")
+	if err != nil {
+		r.report("passwd", fmt.Errorf("failed to stat passwd: %w", err))
+		return ""
+	}
+	if r.users == nil || !info.ModTime().Equal(r.modTime) || info.Size() != r.size {
+		users, err := parsePasswd(r.root)
+		if err != nil {
+			r.report("passwd", fmt.Errorf("failed to parse passwd: %w", err))
+			return ""
+		}
+		r.users, r.modTime, r.size = users, info.ModTime(), info.Size()
+	}
+	return r.users[uid]
+}
+
+// parsePasswd maps the UIDs in etc/passwd below root to user names.
+func parsePasswd(root fs.FS) (map[string]string, error) {
+	f, err := root.Open("etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name:password:UID:GID:GECOS:directory:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, ok := users[fields[2]]; !ok {
+			users[fields[2]] = fields[0]
+		}
+	}
+	return users, scanner.Err()
+}
+
+// nssMissTTL is how long a UID NSS doesn't resolve is not looked up again, as
+// the user may be created later or the directory service be unreachable.
+const nssMissTTL = time.Minute
+
+// nssResolver resolves UIDs to user names through NSS, so users from LDAP or
+// systemd-homed are found too. Lookups can be slow, so results are cached,
+// and made without holding mu.
+type nssResolver struct {
+	lookupID func(uid string) (*user.User, error)
+
+	mu    sync.Mutex
+	users map[string]nssEntry
+}
+
+// nssEntry is a cached lookup. Misses expire, names are kept.
+type nssEntry struct {
+	name    string
+	expires time.Time
+}
+
+func newNSSResolver() *nssResolver {
+	return &nssResolver{lookupID: user.LookupId, users: make(map[string]nssEntry)}
+}
+
+func (r *nssResolver) lookup(uid string) string {
+	r.mu.Lock()
+	e, ok := r.users[uid]
+	r.mu.Unlock()
+	if ok && (e.name != "" || time.Now().Before(e.expires)) {
+		return e.name
+	}
+	e = nssEntry{}
+	u, err := r.lookupID(uid)
+	if err != nil {
+		slog.Debug("failed to look up user", "uid", uid, "error", err)
+		e.expires = time.Now().Add(nssMissTTL)
+	} else {
+		e.name = u.Username
+	}
+	r.mu.Lock()
+	r.users[uid] = e
+	r.mu.Unlock()
+	return e.name
+}
+
+// WithUserLabels adds uid and user labels to the cgroups below
+// user-<uid>.slice and user@<uid>.service. User names are resolved from
+// etc/passwd below root, which should be the host's root directory. If root
+// is nil, they are looked up through NSS instead.
+func WithUserLabels(root fs.FS) Option {
+	return func(c *cgroupCollector) {
+		var lookup func(uid string) string
+		if root != nil {
+			lookup = (&passwdResolver{root: root, report: c.labelErrorReporter()}).lookup
+		} else {
+			lookup = newNSSResolver().lookup
+		}
+		c.labelers = append(c.labelers, labeler{
+			names: []string{"uid", "user"},
+			values: func(cgroup string) []string {
+				uid, ok := parseUID(cgroup)
+				if !ok {
+					return []string{"", ""}
+				}
+				return []string{uid, lookup(uid)}
+			},
+		})
+	}
+}
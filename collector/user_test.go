@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"os/user"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParseUID(t *testing.T) {
+	tests := map[string]string{
+		"user.slice/user-1000.slice":                                          "1000",
+		"user.slice/user-1000.slice/session-2.scope":                          "1000",
+		"user.slice/user-1000.slice/user@1000.service":                        "1000",
+		"user.slice/user-1000.slice/user@1000.service/app.slice/foot.service": "1000",
+		"user.slice": "",
+		"system.slice/user-runtime-dir@1000.service": "",
+	}
+	for cgroup, expected := range tests {
+		if uid, _ := parseUID(cgroup); uid != expected {
+			t.Errorf("%s: expected %q got %q", cgroup, expected, uid)
+		}
+	}
+}
+
+func TestUserLabels(t *testing.T) {
+	root := fstest.MapFS{
+		"etc/passwd": &fstest.MapFile{Data: []byte("root:x:0:0:System administrator:/root:/bin/sh\narian:x:1000:100::/home/arian:/bin/sh\n")},
+	}
+	c := New(cgroup, "", WithUserLabels(root)).(*cgroupCollector)
+	labels := c.labels("user.slice/user-1000.slice/user@1000.service/app.slice")
+	if labels[1] != "1000" || labels[2] != "arian" {
+		t.Errorf("expected 1000 arian got %q", labels)
+	}
+	labels = c.labels("user.slice/user-132.slice")
+	if labels[1] != "132" || labels[2] != "" {
+		t.Errorf("expected 132 and no user got %q", labels)
+	}
+	labels = c.labels("system.slice")
+	if labels[1] != "" || labels[2] != "" {
+		t.Errorf("expected no labels got %q", labels)
+	}
+}
+
+func TestNSSMissesExpire(t *testing.T) {
+	lookups := 0
+	var users map[string]string
+	r := newNSSResolver()
+	r.lookupID = func(uid string) (*user.User, error) {
+		lookups++
+		if name, ok := users[uid]; ok {
+			return &user.User{Uid: uid, Username: name}, nil
+		}
+		return nil, user.UnknownUserIdError(1000)
+	}
+	if name := r.lookup("1000"); name != "" || lookups != 1 {
+		t.Errorf("expected a miss got %q after %d lookups", name, lookups)
+	}
+	users = map[string]string{"1000": "arian"}
+	if name := r.lookup("1000"); name != "" || lookups != 1 {
+		t.Errorf("expected the cached miss got %q after %d lookups", name, lookups)
+	}
+	e := r.users["1000"]
+	e.expires = time.Now().Add(-time.Second)
+	r.users["1000"] = e
+	if name := r.lookup("1000"); name != "arian" || lookups != 2 {
+		t.Errorf("expected the expired miss to be looked up again got %q after %d lookups", name, lookups)
+	}
+	if name := r.lookup("1000"); name != "arian" || lookups != 2 {
+		t.Errorf("expected the cached name got %q after %d lookups", name, lookups)
+	}
+}
+
+func TestPasswdErrorsAreReported(t *testing.T) {
+	var errs []error
+	c := New(cgroup, "", WithUserLabels(fstest.MapFS{}), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})).(*cgroupCollector)
+	c.labels("user.slice/user-1000.slice")
+	if len(errs) != 1 {
+		t.Errorf("expected the missing passwd to be reported got %v", errs)
+	}
+	if n := c.stats.errorCounts[errorKey{"passwd", reasonLabel}]; n != 1 {
+		t.Errorf("expected 1 passwd error got %f", n)
+	}
+}
@@ -0,0 +1,21 @@
+package collector
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// vanished reports whether err is caused by a cgroup that was removed. The
+// files of a removed cgroup fail with ENODEV while they are still open, and
+// with ENOENT once its directory is gone.
+func vanished(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENODEV)
+}
+
+// vanish counts the cgroup as removed, once per scrape.
+func (c *cgroupCollector) vanish(cgroup *cgroupEntry) {
+	if cgroup.vanished.CompareAndSwap(false, true) {
+		c.stats.cgroupVanished()
+	}
+}
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// vanishingfs removes cgroups while they are walked: listing gone fails with
+// ENOENT and reading the files of dying fails with ENODEV.
+type vanishingfs struct {
+	fstest.MapFS
+	gone, dying string
+}
+
+func (v vanishingfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == v.gone {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOENT}
+	}
+	return v.MapFS.ReadDir(name)
+}
+
+func (v vanishingfs) Open(name string) (fs.File, error) {
+	if strings.HasPrefix(name, v.dying+"/") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.ENODEV}
+	}
+	return v.MapFS.Open(name)
+}
+
+func TestToleratesVanishedCgroups(t *testing.T) {
+	mapfs := vanishingfs{
+		MapFS: fstest.MapFS{
+			"system.slice/a.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+			"system.slice/b.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+			"system.slice/c.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+			"system.slice/c.service/memory.max":     &fstest.MapFile{Data: []byte("2\n")},
+			"system.slice/d.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+		},
+		gone:  "system.slice/b.service",
+		dying: "system.slice/c.service",
+	}
+	c := New(mapfs, "").(*cgroupCollector)
+	c.errorHandler = func(err error) {
+		t.Error(err)
+	}
+	values := collectValues(c)
+	var cgroups []string
+	for key := range values {
+		cgroups = append(cgroups, key[1])
+	}
+	slices.Sort(cgroups)
+	expected := []string{"system.slice/a.service", "system.slice/d.service"}
+	if !slices.Equal(cgroups, expected) {
+		t.Errorf("expected %v got %v", expected, cgroups)
+	}
+	if c.stats.vanishedCgroups != 2 {
+		t.Errorf("expected 2 vanished cgroups got %f", c.stats.vanishedCgroups)
+	}
+}
+
+// deniedfs fails to list denied.
+type deniedfs struct {
+	fstest.MapFS
+	denied string
+}
+
+func (d deniedfs) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == d.denied {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.EACCES}
+	}
+	return d.MapFS.ReadDir(name)
+}
+
+func TestSkipsUnwalkableCgroups(t *testing.T) {
+	mapfs := deniedfs{
+		MapFS: fstest.MapFS{
+			"a.slice/memory.current":           &fstest.MapFile{Data: []byte("1\n")},
+			"a.slice/a.service/memory.current": &fstest.MapFile{Data: []byte("1\n")},
+			"b.slice/memory.current":           &fstest.MapFile{Data: []byte("1\n")},
+			"c.slice/memory.current":           &fstest.MapFile{Data: []byte("1\n")},
+		},
+		denied: "a.slice",
+	}
+	c := New(mapfs, "").(*cgroupCollector)
+	var errs []error
+	c.errorHandler = func(err error) {
+		errs = append(errs, err)
+	}
+	values := collectValues(c)
+	for _, cgroup := range []string{"b.slice", "c.slice"} {
+		if _, ok := values[[2]string{"cgroup_memory_current_bytes", cgroup}]; !ok {
+			t.Errorf("expected the metrics of %s", cgroup)
+		}
+	}
+	if _, ok := values[[2]string{"cgroup_memory_current_bytes", "a.slice/a.service"}]; ok {
+		t.Error("expected a.slice not to be walked")
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], syscall.EACCES) {
+		t.Errorf("expected the error walking a.slice got %v", errs)
+	}
+	if n := c.stats.errorCounts[errorKey{"", reasonWalk}]; n != 1 {
+		t.Errorf("expected 1 walk error got %f", n)
+	}
+}
@@ -0,0 +1,75 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parallel calls f for 0 to n-1 with up to c.workers goroutines.
+func (c *cgroupCollector) parallel(n int, f func(i int)) {
+	if c.workers <= 1 {
+		for i := range n {
+			f(i)
+		}
+		return
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range min(c.workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				f(i)
+			}
+		}()
+	}
+	for i := range n {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// collectCgroups collects the cgroups in parallel.
+func (c *cgroupCollector) collectCgroups(cgroups []*cgroupEntry, m chan<- prometheus.Metric) {
+	c.parallel(len(cgroups), func(i int) {
+		c.collectCgroup(cgroups[i], m)
+	})
+}
+
+// gatherCgroups collects the cgroups in parallel and returns the metrics of
+// each.
+func (c *cgroupCollector) gatherCgroups(cgroups []*cgroupEntry) [][]prometheus.Metric {
+	metrics := make([][]prometheus.Metric, len(cgroups))
+	c.parallel(len(cgroups), func(i int) {
+		metrics[i] = gather(func(m chan<- prometheus.Metric) {
+			c.collectCgroup(cgroups[i], m)
+		})
+	})
+	return metrics
+}
+
+// gather returns the metrics collect sends.
+func gather(collect func(chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		defer close(ch)
+		collect(ch)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// WithWorkers collects up to n cgroups at the same time, which speeds up
+// scrapes of large hierarchies. By default cgroups are collected one after
+// another. Discovering the cgroups is not parallelized.
+func WithWorkers(n int) Option {
+	return func(c *cgroupCollector) {
+		c.workers = n
+	}
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeTree writes a hierarchy of n services like NetworkManager.service of
+// the fixtures below a temporary directory, and returns the directory.
+func writeTree(tb testing.TB, n int) string {
+	tb.Helper()
+	service, err := fs.Sub(cgroup, "fixtures/cgroup/system.slice/NetworkManager.service")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	entries, err := fs.ReadDir(service, ".")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	dir := tb.TempDir()
+	for i := range n {
+		path := filepath.Join(dir, "system.slice", fmt.Sprintf("service-%d.service", i))
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		for _, entry := range entries {
+			buf, err := fs.ReadFile(service, entry.Name())
+			if err != nil {
+				tb.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(path, entry.Name()), buf, 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return dir
+}
+
+func TestWorkersCollectTheSame(t *testing.T) {
+	fsys := os.DirFS(writeTree(t, 50))
+	serial := collectValues(New(fsys, "").(*cgroupCollector))
+	parallel := collectValues(New(fsys, "", WithWorkers(8)).(*cgroupCollector))
+	if len(serial) == 0 || !maps.Equal(serial, parallel) {
+		t.Errorf("expected %d values got %d", len(serial), len(parallel))
+	}
+
+	limits := Limits{MaxCgroups: 20}
+	serial = collectValues(New(fsys, "", WithLimits(limits)).(*cgroupCollector))
+	parallel = collectValues(New(fsys, "", WithLimits(limits), WithWorkers(8)).(*cgroupCollector))
+	if len(serial) == 0 || !maps.Equal(serial, parallel) {
+		t.Errorf("expected %d limited values got %d", len(serial), len(parallel))
+	}
+}
+
+func BenchmarkCollect(b *testing.B) {
+	dir := writeTree(b, 2000)
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			c := New(DirFS(dir), "", WithWorkers(workers))
+			b.ReportAllocs()
+			for range b.N {
+				metrics := make(chan prometheus.Metric)
+				go func() {
+					defer close(metrics)
+					c.Collect(metrics)
+				}()
+				for range metrics {
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCollectByPath collects through a file system that can't open
+// directories, so files are opened by their whole path.
+func BenchmarkCollectByPath(b *testing.B) {
+	c := New(os.DirFS(writeTree(b, 2000)), "")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		metrics := make(chan prometheus.Metric)
+		go func() {
+			defer close(metrics)
+			c.Collect(metrics)
+		}()
+		for range metrics {
+		}
+	}
+}
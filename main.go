@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/arianvp/cgroup-exporter/collector"
 	"github.com/prometheus/client_golang/prometheus"
@@ -17,14 +23,113 @@ import (
 
 func main() {
 	addr := flag.String("listen-address", ":13232", "address to listen on")
-	cgroup := flag.String("cgroup", "", "what cgroup to monitor. Can be a blob. If empty all cgroups are monitored.")
+	var includes, excludes []string
+	flag.Func("cgroup", "what cgroup to monitor, with its descendants. Can be a glob, in which ** matches any number of path elements. Can be repeated. If empty all cgroups are monitored.", func(s string) error {
+		includes = append(includes, s)
+		return collector.ValidatePattern(s)
+	})
+	flag.Func("cgroup.exclude", "what cgroup not to monitor, with its descendants. Can be a glob like -cgroup. Can be repeated.", func(s string) error {
+		excludes = append(excludes, s)
+		return collector.ValidatePattern(s)
+	})
+	var rollups []string
+	flag.Func("rollup", "sum up the sibling cgroups matching a glob like -cgroup into one cgroup named after the glob's last element, e.g. user.slice/*/session-*.scope. Can be repeated.", func(s string) error {
+		rollups = append(rollups, s)
+		return collector.ValidatePattern(s)
+	})
+	maxDepth := flag.Int("max-depth", 0, "maximum depth of the cgroups to monitor below the root of the hierarchy. 0 means unlimited.")
+	maxCgroups := flag.Int("limit.cgroups", 0, "maximum number of cgroups to export per scrape. 0 means unlimited.")
+	maxSeries := flag.Int("limit.series", 0, "maximum number of series to export per scrape. 0 means unlimited.")
+	configFile := flag.String("config.file", "", "path to a JSON configuration file.")
+	containerLabels := flag.Bool("labels.containers", false, "add runtime and container_id labels to cgroups of Docker, Podman, LXC/Incus and containerd containers.")
+	resolveContainers := flag.Bool("labels.containers.resolve", false, "resolve container names and images from the container runtime's state on disk.")
+	deviceNames := flag.Bool("labels.devices", false, "add device_name, rotational and model labels to io.stat metrics from /sys/dev/block.")
+	userLabels := flag.Bool("labels.users", false, "add uid and user labels to the cgroups of user slices.")
+	userNSS := flag.Bool("labels.users.nss", false, "resolve user names through NSS instead of /etc/passwd.")
+	machineLabels := flag.Bool("labels.machines", false, "add machine and machine_class labels to the cgroups of VMs and containers registered with systemd-machined.")
+	workers := flag.Int("collector.workers", runtime.GOMAXPROCS(0), "number of cgroups to collect at the same time.")
+	indexCgroups := flag.Bool("collector.index", false, "keep the cgroup directories in memory, maintained with inotify, instead of walking the hierarchy on every scrape.")
+	resync := flag.Duration("collector.index.resync", 5*time.Minute, "interval at which the index of -collector.index is rebuilt, in case a change was missed.")
+	timeoutOffset := flag.Duration("web.timeout-offset", 500*time.Millisecond, "time subtracted from the scrape timeout Prometheus sends, so scrapes stop and return what they collected before Prometheus gives up on them.")
+	backgroundInterval := flag.Duration("collector.background", 0, "collect the cgroups in the background at this interval and serve the latest samples, with their timestamps, instead of collecting on every scrape. 0 collects on every scrape.")
+	skipUnpopulated := flag.Bool("collector.skip-unpopulated", false, "skip the cgroups without processes in them or their descendants, according to cgroup.events.")
+	unpopulatedInfo := flag.Bool("collector.skip-unpopulated.info", false, "still export cgroup_info for the unpopulated cgroups skipped.")
+	invocationIDs := flag.Bool("collector.invocation-ids", false, "export the systemd invocation ID of each unit, read from the extended attributes of its cgroup.")
+	var selection collector.Selection
+	flag.StringVar(&selection.Preset, "collector.preset", "", "set of files to collect: minimal, standard or full.")
+	flag.Func("collector.disable", "comma-separated list of files or controllers not to collect, e.g. memory.stat,io.", func(s string) error {
+		selection.Disable = append(selection.Disable, strings.Split(s, ",")...)
+		return nil
+	})
+	for _, name := range collector.Controllers() {
+		flag.Var(selectFlag{name: name, selection: &selection}, "collector."+name, "collect the files of the "+name+" controller.")
+	}
+	for _, name := range collector.Files() {
+		flag.Var(selectFlag{name: name, selection: &selection}, "collector."+name, "collect "+name+".")
+	}
 	flag.Parse()
-	cgroupfs := os.DirFS("/sys/fs/cgroup")
-	registry := prometheus.NewRegistry()
-	registry.MustRegister(collector.New(cgroupfs, *cgroup))
-	http.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
+	cgroupfs := collector.DirFS("/sys/fs/cgroup")
+	config := &collector.Config{}
+	if *configFile != "" {
+		var err error
+		if config, err = collector.LoadConfig(*configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	config.Collectors = config.Collectors.Override(selection)
+	config.Rollups = append(config.Rollups, rollups...)
+	if *maxCgroups > 0 {
+		config.Limits.MaxCgroups = *maxCgroups
+	}
+	if *maxSeries > 0 {
+		config.Limits.MaxSeries = *maxSeries
+	}
+	opts, err := config.Options()
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts = append(opts, collector.WithInclude(includes...), collector.WithExclude(excludes...), collector.WithMaxDepth(*maxDepth))
+	if *containerLabels {
+		var root fs.FS
+		if *resolveContainers {
+			root = os.DirFS("/")
+		}
+		opts = append(opts, collector.WithContainerLabels(root))
+	}
+	if *deviceNames {
+		opts = append(opts, collector.WithDeviceNames(os.DirFS("/sys")))
+	}
+	if *userLabels {
+		var root fs.FS
+		if !*userNSS {
+			root = os.DirFS("/")
+		}
+		opts = append(opts, collector.WithUserLabels(root))
+	}
+	if *machineLabels {
+		opts = append(opts, collector.WithMachineLabels(os.DirFS("/")))
+	}
+	opts = append(opts, collector.WithWorkers(*workers), collector.WithSelfMetrics())
+	if *indexCgroups {
+		opts = append(opts, collector.WithIndex(ctx, *resync))
+	}
+	if *backgroundInterval > 0 {
+		opts = append(opts, collector.WithBackground(ctx, *backgroundInterval, config.Schedules...))
+	} else if len(config.Schedules) > 0 {
+		log.Print("schedules are ignored unless collecting in the background with -collector.background")
+	}
+	if *skipUnpopulated {
+		opts = append(opts, collector.WithSkipUnpopulated(*unpopulatedInfo))
+	}
+	if *invocationIDs {
+		opts = append(opts, collector.WithInvocationIDs())
+	}
+	c := collector.New(cgroupfs, "", opts...)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	http.Handle("/metrics", metricsHandler(c, registry, *timeoutOffset))
 	ctx, cancelCause := context.WithCancelCause(ctx)
 	go func() {
 		cancelCause(http.ListenAndServe(*addr, nil))
@@ -37,3 +142,93 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// selectFlag is a boolean flag that enables or disables collecting a file or
+// controller.
+type selectFlag struct {
+	name      string
+	selection *collector.Selection
+}
+
+func (f selectFlag) String() string {
+	return ""
+}
+
+func (f selectFlag) Set(s string) error {
+	enable, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if enable {
+		f.selection.Enable = append(f.selection.Enable, f.name)
+	} else {
+		f.selection.Disable = append(f.selection.Disable, f.name)
+	}
+	return nil
+}
+
+func (f selectFlag) IsBoolFlag() bool {
+	return true
+}
+
+// metricsHandler serves the metrics of registry, unless the request filters
+// the cgroups or files to collect with cgroup or collect[] parameters or has a
+// scrape timeout, in which case it serves a view of c. Scrapes with a timeout
+// stop offset before it, with the metrics collected until then.
+func metricsHandler(c prometheus.Collector, registry *prometheus.Registry, offset time.Duration) http.Handler {
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		patterns, collect := query["cgroup"], query["collect[]"]
+		timeout, err := scrapeTimeout(r, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(patterns) == 0 && len(collect) == 0 && timeout == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		view := c
+		if len(patterns) > 0 || len(collect) > 0 {
+			if view, err = collector.Filter(view, patterns, collect); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			if view, err = collector.Context(ctx, view); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		viewRegistry := prometheus.NewRegistry()
+		if err := viewRegistry.Register(view); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promhttp.HandlerFor(viewRegistry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// scrapeTimeout returns the time the scrape r may take, according to the
+// X-Prometheus-Scrape-Timeout-Seconds header, minus offset. It returns 0 if
+// the request has no timeout.
+func scrapeTimeout(r *http.Request, offset time.Duration) (time.Duration, error) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid X-Prometheus-Scrape-Timeout-Seconds %q", header)
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - offset
+	if timeout <= 0 {
+		// leave at least some time to collect
+		timeout = time.Duration(seconds * float64(time.Second) / 2)
+	}
+	return timeout, nil
+}